@@ -0,0 +1,542 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// newFromFunc returns a new integral image for img, where the value
+// accumulated for each pixel is the result of calling f on its colour.
+// The integral image always starts at (0, 0), whatever the bounds of
+// img are.
+func newFromFunc(img image.Image, f func(c color.Color) uint64) *Image {
+	return newFromFuncXY(img, func(x, y int, c color.Color) uint64 {
+		return f(c)
+	})
+}
+
+// fromImage returns a new integral image of the 16 bit grayscale
+// values of img.
+func fromImage(img image.Image) *Image {
+	return newFromFunc(img, func(c color.Color) uint64 {
+		return uint64(gray16(c))
+	})
+}
+
+// newFromFuncXY is like newFromFunc, but also passes f the coordinates
+// of each pixel in the integral image.
+func newFromFuncXY(img image.Image, f func(x, y int, c color.Color) uint64) *Image {
+	b := img.Bounds()
+	return newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return f(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+	})
+}
+
+// newFromValues returns a new integral image of the given size,
+// where the value accumulated for each pixel is the result of
+// calling f with its coordinates.
+func newFromValues(w, h int, f func(x, y int) uint64) *Image {
+	i, _ := newFromValuesContext(context.Background(), w, h, f, nil)
+	return i
+}
+
+// newFromValuesContext is like newFromValues, but checks ctx before
+// each row, returning its error along with a nil image if it is done,
+// and accumulates the values with add, or with plain addition if add
+// is nil.
+func newFromValuesContext(ctx context.Context, w, h int, f func(x, y int) uint64, add func(a, b uint64) uint64) (*Image, error) {
+	if add == nil {
+		add = func(a, b uint64) uint64 { return a + b }
+	}
+	in := NewImage(image.Rect(0, 0, w, h))
+	i := *in
+	for y := 0; y < h; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var rowsum uint64
+		for x := 0; x < w; x++ {
+			rowsum = add(rowsum, f(x, y))
+			i[y][x] = rowsum
+			if y > 0 {
+				i[y][x] = add(i[y][x], i[y-1][x])
+			}
+		}
+	}
+	return in, nil
+}
+
+// grayValues returns the 16 bit grayscale values of each pixel of
+// img, indexed as [y][x] from (0, 0).
+func grayValues(img image.Image) [][]uint16 {
+	b := img.Bounds()
+	rows := make([][]uint16, b.Dy())
+	for y := range rows {
+		rows[y] = make([]uint16, b.Dx())
+		for x := range rows[y] {
+			rows[y][x] = gray16(img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return rows
+}
+
+// NewFromImageContext returns a new integral image of the 16 bit
+// grayscale values of img, like drawing it onto an Image, but checks
+// ctx before each row, so that building the integral image of a very
+// large image can be abandoned. If ctx is done, its error is returned
+// along with a nil image.
+func NewFromImageContext(ctx context.Context, img image.Image) (*Image, error) {
+	b := img.Bounds()
+	return newFromValuesContext(ctx, b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return uint64(gray16(img.At(b.Min.X+x, b.Min.Y+y)))
+	}, nil)
+}
+
+// NewBitPlaneImage returns a new integral image of a single bit-plane
+// of src, so each pixel contributes either 0 or 1. Mean() over a
+// region of the result is therefore the density of set bits of that
+// plane in the region, which is useful for analysing halftoned or
+// dithered scans.
+//
+// Planes index the bits of the 16 bit grayscale value of each pixel,
+// from 0 for the least significant bit to 15 for the most significant.
+// Note that 8 bit sources are promoted to 16 bits by repeating the
+// byte, so for them planes 8-15 are the original planes 0-7, as are
+// planes 0-7. NewBitPlaneImage panics if plane is outside 0-15.
+func NewBitPlaneImage(src image.Image, plane int) *Image {
+	if plane < 0 || plane > 15 {
+		panic("integral: bit-plane out of range")
+	}
+	return newFromFunc(src, func(c color.Color) uint64 {
+		return uint64(gray16(c)>>uint(plane)) & 1
+	})
+}
+
+// NewAlphaFromImage returns a new integral image of the alpha channel
+// of img, with each pixel contributing its 16 bit alpha value.
+//
+// Colours are converted to grayscale after alpha premultiplication,
+// so an integral image built by drawing a partially transparent image
+// holds premultiplied values, and its Mean() is darkened by any
+// transparency. The coverage weighted mean of the original colours
+// over a region can be found by dividing the sum of the value integral
+// image by the sum of the alpha integral image over the same region,
+// and scaling by the maximum alpha value:
+//
+//	mean := float64(value.Sum(r)) / float64(alpha.Sum(r)) * 0xffff
+//
+// The mean is undefined if the region is fully transparent, in which
+// case alpha.Sum(r) is 0.
+func NewAlphaFromImage(img image.Image) *Image {
+	return newFromFunc(img, func(c color.Color) uint64 {
+		_, _, _, a := c.RGBA()
+		return uint64(a)
+	})
+}
+
+// Builder builds an integral image one row at a time, for example as
+// rows of an image are decoded, so that the whole source image never
+// needs to be held in memory. The number of rows does not need to be
+// known in advance.
+type Builder struct {
+	img   Image
+	width int
+}
+
+// NewBuilder returns a new Builder for an integral image with rows of
+// the given width.
+func NewBuilder(width int) *Builder {
+	return &Builder{width: width}
+}
+
+// AddRow adds the next row of 16 bit grayscale values to the bottom
+// of the image. It panics if the row is not the width of the image.
+func (b *Builder) AddRow(pix []uint16) {
+	if len(pix) != b.width {
+		panic("integral: wrong row width to add")
+	}
+	row := make([]uint64, b.width)
+	var above []uint64
+	if len(b.img) > 0 {
+		above = b.img[len(b.img)-1]
+	}
+	var rowsum uint64
+	for x, v := range pix {
+		rowsum += uint64(v)
+		row[x] = rowsum
+		if above != nil {
+			row[x] += above[x]
+		}
+	}
+	b.img = append(b.img, row)
+}
+
+// Finish returns the integral image of the rows added so far. The
+// Builder should not be used afterwards.
+func (b *Builder) Finish() *Image {
+	img := b.img
+	b.img = nil
+	return &img
+}
+
+// BandedBuilder builds an integral image from horizontal bands of
+// rows, which can be filled concurrently by separate goroutines.
+// Each band is integrated independently by FillBand, and the sums
+// are carried down from band to band by Seal once every band has
+// been filled.
+//
+// FillBand must be called exactly once for each band before Seal is
+// called; Seal blocks until this has happened.
+type BandedBuilder struct {
+	img        Image
+	bandHeight int
+	wg         sync.WaitGroup
+}
+
+// NewBandedBuilder returns a new BandedBuilder for an integral image
+// with the given bounds, split into the given number of bands.
+func NewBandedBuilder(r image.Rectangle, bands int) *BandedBuilder {
+	var b BandedBuilder
+	b.img = *NewImage(r)
+	if bands < 1 {
+		bands = 1
+	}
+	b.bandHeight = (r.Dy() + bands - 1) / bands
+	if b.bandHeight < 1 {
+		b.bandHeight = 1
+	}
+	b.wg.Add(b.Bands())
+	return &b
+}
+
+// Bands returns the number of bands in the image. This may be fewer
+// than requested if the image has fewer rows than that.
+func (b *BandedBuilder) Bands() int {
+	return (len(b.img) + b.bandHeight - 1) / b.bandHeight
+}
+
+// Band returns the section of the image covered by a band.
+func (b *BandedBuilder) Band(band int) image.Rectangle {
+	r := b.img.Bounds()
+	r.Min.Y = band * b.bandHeight
+	r.Max.Y = lowest(r.Min.Y+b.bandHeight, r.Max.Y)
+	return r
+}
+
+// FillBand integrates the pixel values of a band, given as a slice
+// of rows. It is safe to call FillBand for different bands
+// concurrently. It panics if the rows given do not match the size
+// of the band.
+func (b *BandedBuilder) FillBand(band int, rows [][]uint64) {
+	r := b.Band(band)
+	if len(rows) != r.Dy() {
+		panic("integral: wrong number of rows for band")
+	}
+	for n, row := range rows {
+		if len(row) != r.Dx() {
+			panic("integral: wrong row width for band")
+		}
+		y := r.Min.Y + n
+		var rowsum uint64
+		for x, v := range row {
+			rowsum += v
+			b.img[y][x] = rowsum
+			if n > 0 {
+				b.img[y][x] += b.img[y-1][x]
+			}
+		}
+	}
+	b.wg.Done()
+}
+
+// Seal waits for all bands to be filled, carries the sums of each
+// band down to the bands below it, and returns the completed
+// integral image.
+func (b *BandedBuilder) Seal() *Image {
+	b.wg.Wait()
+	for band := 1; band < b.Bands(); band++ {
+		r := b.Band(band)
+		carry := b.img[r.Min.Y-1]
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x, c := range carry {
+				b.img[y][x] += c
+			}
+		}
+	}
+	return &b.img
+}
+
+// NewSoftInkImage returns a new integral image of the soft "inkiness"
+// of each pixel of src, for a density measure which is less sensitive
+// to the exact threshold than a hard one. Pixels darker than center
+// are considered ink and those lighter are not, with a smooth
+// transition between the two over a range of width grayscale values
+// around center.
+//
+// The transition is the smoothstep function, 3t² - 2t³, where t runs
+// linearly from 0 at center+width/2 to 1 at center-width/2. A width
+// of 0 gives a hard threshold, with only pixels below center counted
+// as ink. The weights are stored in 16 bit fixed point, with 0xffff
+// representing a pixel which is fully ink, so the Mean() of a region
+// divided by 0xffff is its soft ink density, from 0 to 1.
+func NewSoftInkImage(src image.Image, center, width uint16) *Image {
+	return newFromFunc(src, func(c color.Color) uint64 {
+		v := float64(gray16(c))
+		if width == 0 {
+			if v < float64(center) {
+				return 0xffff
+			}
+			return 0
+		}
+		t := (float64(center) + float64(width)/2 - v) / float64(width)
+		switch {
+		case t <= 0:
+			return 0
+		case t >= 1:
+			return 0xffff
+		}
+		return uint64(math.Round(t * t * (3 - 2*t) * 0xffff))
+	})
+}
+
+// NewFromGray8 returns a new integral image built directly from a
+// buffer of 8 bit grayscale pixels, laid out as in image.Gray, with
+// stride bytes between the start of each row. This avoids the
+// overhead of wrapping the buffer in an image.Image and drawing it.
+// Values are promoted to 16 bits in the same way as when drawing an
+// image.Gray, by multiplying by 257, so the result is identical.
+func NewFromGray8(pix []byte, width, height, stride int) *Image {
+	in := NewImage(image.Rect(0, 0, width, height))
+	i := *in
+	for y := 0; y < height; y++ {
+		src := pix[y*stride : y*stride+width]
+		var rowsum uint64
+		for x, v := range src {
+			rowsum += uint64(v) * 0x101
+			i[y][x] = rowsum
+			if y > 0 {
+				i[y][x] += i[y-1][x]
+			}
+		}
+	}
+	return in
+}
+
+// NewFromYCbCrLuma returns a new integral image of the luma, or Y,
+// plane of a YCbCr image, such as a decoded JPEG or video frame,
+// reading it directly rather than converting each pixel to RGB and
+// back to grayscale as drawing the image would. Values are promoted to
+// 16 bits by multiplying by 257, as with NewFromGray8. The result can
+// differ very slightly from drawing the image, as the colour conversion
+// there is not exact.
+func NewFromYCbCrLuma(img *image.YCbCr) *Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return NewImage(b)
+	}
+	return NewFromGray8(img.Y[img.YOffset(b.Min.X, b.Min.Y):], b.Dx(), b.Dy(), img.YStride)
+}
+
+// NewFromGray returns a new integral image of an 8 bit grayscale
+// image, holding its values as they are, in the range 0-255. This
+// differs from drawing img onto an Image, which promotes each value to
+// 16 bits by multiplying it by 257, so here Mean returns values in the
+// range 0-255 rather than 0-65535. Note that other functions in this
+// package which work on 16 bit values, such as At, will not give
+// meaningful results for the returned image.
+func NewFromGray(img *image.Gray) *Image {
+	b := img.Bounds()
+	return newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return uint64(img.Pix[y*img.Stride+x])
+	})
+}
+
+// NewFromPaletted returns a new integral image of a paletted image,
+// where the value of each pixel is the result of calling valueFn with
+// its palette index, rather than being taken from the colour in the
+// palette. This allows indices to be given arbitrary values, such as
+// 0xffff for an index representing ink and 0 for all others.
+func NewFromPaletted(img *image.Paletted, valueFn func(index uint8) uint16) *Image {
+	b := img.Bounds()
+	return newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return uint64(valueFn(img.ColorIndexAt(b.Min.X+x, b.Min.Y+y)))
+	})
+}
+
+// NewDiffImage returns a new integral image of the absolute difference
+// between the 16 bit grayscale values of two aligned images, such as
+// consecutive frames of a video. The Mean() of a region of the result
+// is then the amount of change, or motion, in that region. An error
+// wrapping ErrBoundsMismatch is returned if the images have different
+// bounds.
+func NewDiffImage(a, b image.Image) (*Image, error) {
+	if !a.Bounds().Eq(b.Bounds()) {
+		return nil, fmt.Errorf("%w: %v and %v", ErrBoundsMismatch, a.Bounds(), b.Bounds())
+	}
+	ga, gb := grayValues(a), grayValues(b)
+	r := a.Bounds()
+	return newFromValues(r.Dx(), r.Dy(), func(x, y int) uint64 {
+		return absdiff(ga[y][x], gb[y][x])
+	}), nil
+}
+
+// NewDeviationSqImage returns a new integral image of the squared
+// difference between each 16 bit grayscale value of img and the mean
+// of the whole image, along with that mean. The Mean() of a region of
+// the result is then its variance relative to the global mean, which
+// is large for regions which stand out from the rest of the image.
+// As integral images hold integers, each squared difference is
+// rounded to the nearest whole number.
+func NewDeviationSqImage(img image.Image) (*Image, float64) {
+	g := grayValues(img)
+	b := img.Bounds()
+	var sum float64
+	for _, row := range g {
+		for _, v := range row {
+			sum += float64(v)
+		}
+	}
+	mean := sum / float64(b.Dx()*b.Dy())
+	return newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		d := float64(g[y][x]) - mean
+		return uint64(math.Round(d * d))
+	}), mean
+}
+
+// NewFromImageWithRange returns a new integral image of img, along
+// with the lowest and highest 16 bit grayscale values found in it,
+// which are gathered while the integral image is built. If img has no
+// pixels both are 0.
+func NewFromImageWithRange(img image.Image) (*Image, uint16, uint16) {
+	var lo, hi uint16
+	first := true
+	i := newFromFunc(img, func(c color.Color) uint64 {
+		v := gray16(c)
+		if first || v < lo {
+			lo = v
+		}
+		if first || v > hi {
+			hi = v
+		}
+		first = false
+		return uint64(v)
+	})
+	return i, lo, hi
+}
+
+// NewDownsampledFromImage returns a new integral image of img shrunk
+// by the given factor, with each pixel being the mean of the
+// corresponding factor by factor block of img, rounded to the nearest
+// whole number. If the size of img is not divisible by factor, the
+// last blocks in each direction are smaller, covering only the
+// remaining pixels. This gives the same result as building a full
+// size integral image and calling DownscaleMean, but without the
+// memory needed for the full size one. A factor of less than 1 is
+// treated as 1.
+func NewDownsampledFromImage(img image.Image, factor int) *Image {
+	factor = highest(factor, 1)
+	b := img.Bounds()
+	w := (b.Dx() + factor - 1) / factor
+	h := (b.Dy() + factor - 1) / factor
+	return newFromValues(w, h, func(x, y int) uint64 {
+		block := image.Rect(x*factor, y*factor, (x+1)*factor, (y+1)*factor)
+		block = block.Add(b.Min).Intersect(b)
+		var sum uint64
+		for sy := block.Min.Y; sy < block.Max.Y; sy++ {
+			for sx := block.Min.X; sx < block.Max.X; sx++ {
+				sum += uint64(gray16(img.At(sx, sy)))
+			}
+		}
+		n := uint64(block.Dx() * block.Dy())
+		return (sum + n/2) / n
+	})
+}
+
+// NewFromImageFunc returns a new integral image of img, where the
+// value accumulated for each pixel is the result of calling f with its
+// 16 bit grayscale value. This generalises the regular integral image,
+// where f returns the value as it is, and the squared integral image,
+// where f returns its square; other functions, such as a lookup table
+// emphasising mid tones, can be used in the same way. The sums wrap
+// on overflow, so for functions giving very large values
+// NewFromImageSaturating may be more appropriate.
+func NewFromImageFunc(img image.Image, f func(gray uint16) uint64) *Image {
+	return newFromFunc(img, func(c color.Color) uint64 {
+		return f(gray16(c))
+	})
+}
+
+// NewFromImageWithGray returns a new integral image of img, using conv
+// to convert each pixel to a 16 bit grayscale value, rather than the
+// luminance weighting of color.Gray16Model. This allows the definition
+// of grayscale to match that used elsewhere, or a single channel to
+// be used; for example the red channel can be taken with:
+//
+//	func(c color.Color) uint16 { r, _, _, _ := c.RGBA(); return uint16(r) }
+//
+// Luminance and Average are provided as ready made conversions.
+func NewFromImageWithGray(img image.Image, conv func(color.Color) uint16) *Image {
+	return newFromFunc(img, func(c color.Color) uint64 {
+		return uint64(conv(c))
+	})
+}
+
+// Luminance converts a colour to 16 bit grayscale using the same
+// luminance weighting of the red, green and blue channels as
+// color.Gray16Model, which is what is used when drawing onto an
+// integral image.
+func Luminance(c color.Color) uint16 {
+	return gray16(c)
+}
+
+// Average converts a colour to 16 bit grayscale using the simple
+// average of the red, green and blue channels.
+func Average(c color.Color) uint16 {
+	r, g, b, _ := c.RGBA()
+	return uint16((r + g + b) / 3)
+}
+
+// saturatingAdd returns a + b, or math.MaxUint64 if that overflows.
+func saturatingAdd(a, b uint64) uint64 {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return math.MaxUint64
+	}
+	return sum
+}
+
+// NewFromImageSaturating returns a new integral image of img, with
+// sums which stop at math.MaxUint64 rather than silently wrapping
+// around if they overflow, which can be detected with Saturated. As
+// with NewFromImageFunc, the value accumulated for each pixel is the
+// result of calling f with its 16 bit grayscale value, or just that
+// value if f is nil; overflow is only possible if f produces very
+// large values, for example due to a bug.
+func NewFromImageSaturating(img image.Image, f func(gray uint16) uint64) *Image {
+	if f == nil {
+		f = func(gray uint16) uint64 { return uint64(gray) }
+	}
+	b := img.Bounds()
+	i, _ := newFromValuesContext(context.Background(), b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return f(gray16(img.At(b.Min.X+x, b.Min.Y+y)))
+	}, saturatingAdd)
+	return i
+}
+
+// Saturated returns whether the sums of an integral image built with
+// NewFromImageSaturating overflowed, in which case any sums involving
+// the saturated values are meaningless. As the sums only increase
+// towards the bottom right, this is simply whether the total is the
+// largest possible value.
+func (i Image) Saturated() bool {
+	return i.Total() == math.MaxUint64
+}
@@ -0,0 +1,682 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// cancellingImage cancels a context once a given number of its
+// pixels have been read.
+type cancellingImage struct {
+	image.Image
+	cancel func()
+	after  int
+}
+
+func (c *cancellingImage) At(x, y int) color.Color {
+	c.after--
+	if c.after == 0 {
+		c.cancel()
+	}
+	return c.Image.At(x, y)
+}
+
+func TestFromImageContext(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	i, err := NewFromImageContext(context.Background(), img)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if !imgsequal(img, i) {
+		t.Errorf("Integral image differs to original\n")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &cancellingImage{Image: img, cancel: cancel, after: b.Dx() * 10}
+	i, err = NewFromImageContext(ctx, c)
+	if !errors.Is(err, context.Canceled) || i != nil {
+		t.Errorf("Expected nil image and context.Canceled, got %v, %v\n", i, err)
+	}
+	if c.after > 0 || c.after < -b.Dx() {
+		t.Errorf("Construction continued after cancellation: %d pixels read afterwards\n", -c.after)
+	}
+}
+
+func TestBitPlane(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			var v uint16
+			if (x+y)%2 == 0 {
+				v = 1 << 3
+			}
+			if y < 2 {
+				v |= 1 << 15
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+
+	cases := []struct {
+		name  string
+		plane int
+		r     image.Rectangle
+		mean  float64
+	}{
+		{"checkerboard", 3, img.Bounds(), 0.5},
+		{"top", 15, image.Rect(0, 0, 4, 2), 1},
+		{"bottom", 15, image.Rect(0, 2, 4, 4), 0},
+		{"unset", 0, img.Bounds(), 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bp := NewBitPlaneImage(img, c.plane)
+			m := bp.Mean(c.r)
+			if m != c.mean {
+				t.Errorf("Mean of bit-plane %d wrong: expected %f, got %f\n", c.plane, c.mean, m)
+			}
+		})
+	}
+}
+
+func TestAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 6; x++ {
+			var a uint8
+			switch {
+			case x < 2:
+				a = 0xff
+			case x < 4:
+				a = 0x80
+			}
+			img.SetNRGBA(x, y, color.NRGBA{0xff, 0xff, 0xff, a})
+		}
+	}
+	b := img.Bounds()
+	value := NewImage(b)
+	draw.Draw(value, b, img, b.Min, draw.Src)
+	alpha := NewAlphaFromImage(img)
+
+	cases := []struct {
+		name   string
+		r      image.Rectangle
+		alpha  uint64
+		weight float64
+	}{
+		{"opaque", image.Rect(0, 0, 2, 2), 4 * 0xffff, 0xffff},
+		{"translucent", image.Rect(2, 0, 4, 2), 4 * 0x8080, 0xffff},
+		{"mixed", image.Rect(0, 0, 6, 2), 4*0xffff + 4*0x8080, 0xffff},
+		{"transparent", image.Rect(4, 0, 6, 2), 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a := alpha.Sum(c.r)
+			if a != c.alpha {
+				t.Fatalf("Alpha sum wrong: expected %d, got %d\n", c.alpha, a)
+			}
+			if a == 0 {
+				return
+			}
+			w := float64(value.Sum(c.r)) / float64(a) * 0xffff
+			if w != c.weight {
+				t.Errorf("Weighted mean wrong: expected %f, got %f\n", c.weight, w)
+			}
+		})
+	}
+
+	if m := value.Mean(image.Rect(2, 0, 4, 2)); m >= 0xffff {
+		t.Errorf("Unweighted mean of translucent region unexpectedly %f\n", m)
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	builder := NewBuilder(b.Dx())
+	for _, row := range grayValues(img) {
+		builder.AddRow(row)
+	}
+	built := builder.Finish()
+	if !reflect.DeepEqual(*integral, *built) {
+		t.Errorf("Integral image built from rows differs to drawn integral image\n")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("AddRow did not panic with a row of the wrong width\n")
+		}
+	}()
+	NewBuilder(5).AddRow(make([]uint16, 4))
+}
+
+func TestBandedBuilder(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	for _, bands := range []int{1, 4, 7, 1000} {
+		t.Run(fmt.Sprintf("%dbands", bands), func(t *testing.T) {
+			builder := NewBandedBuilder(b, bands)
+			var wg sync.WaitGroup
+			for band := 0; band < builder.Bands(); band++ {
+				wg.Add(1)
+				go func(band int) {
+					defer wg.Done()
+					r := builder.Band(band)
+					var rows [][]uint64
+					for y := r.Min.Y; y < r.Max.Y; y++ {
+						row := make([]uint64, r.Dx())
+						for x := range row {
+							row[x] = uint64(gray16(img.At(x, y)))
+						}
+						rows = append(rows, row)
+					}
+					builder.FillBand(band, rows)
+				}(band)
+			}
+			banded := builder.Seal()
+			wg.Wait()
+
+			if !reflect.DeepEqual(*integral, *banded) {
+				t.Errorf("Banded integral image differs to drawn integral image\n")
+			}
+		})
+	}
+}
+
+func TestSoftInk(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 5, 1))
+	for x, v := range []uint16{0, 1000, 30000, 32768, 65535} {
+		img.SetGray16(x, 0, color.Gray16{v})
+	}
+
+	cases := []struct {
+		name   string
+		center uint16
+		width  uint16
+		r      image.Rectangle
+		mean   float64
+	}{
+		{"dark", 32768, 4096, image.Rect(0, 0, 2, 1), 0xffff},
+		{"light", 32768, 4096, image.Rect(4, 0, 5, 1), 0},
+		{"center", 32768, 4096, image.Rect(3, 0, 4, 1), 32768},
+		{"transition", 32768, 8192, image.Rect(2, 0, 3, 1), 60927},
+		{"hard", 32768, 0, image.Rect(0, 0, 5, 1), 0xffff * 3 / 5.0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ink := NewSoftInkImage(img, c.center, c.width)
+			m := ink.Mean(c.r)
+			if m != c.mean {
+				t.Errorf("Mean of soft ink wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+}
+
+func TestFromGray8(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	// copy into a buffer with a wider stride than needed
+	stride := b.Dx() + 13
+	pix := make([]byte, stride*b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			pix[y*stride+x] = img.(*image.Gray).GrayAt(x, y).Y
+		}
+	}
+
+	g := NewFromGray8(pix, b.Dx(), b.Dy(), stride)
+	if !reflect.DeepEqual(*integral, *g) {
+		t.Errorf("Integral image built from buffer differs to drawn integral image\n")
+	}
+}
+
+// newYCbCrFromGray returns a YCbCr image with the same luma as a
+// grayscale image, and neutral chroma.
+func newYCbCrFromGray(gray *image.Gray) *image.YCbCr {
+	b := gray.Bounds()
+	img := image.NewYCbCr(b, image.YCbCrSubsampleRatio420)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.Y[img.YOffset(x, y)] = gray.GrayAt(x, y).Y
+		}
+	}
+	for n := range img.Cb {
+		img.Cb[n] = 128
+		img.Cr[n] = 128
+	}
+	return img
+}
+
+func TestFromYCbCrLuma(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	ycbcr := newYCbCrFromGray(img.(*image.Gray))
+
+	for _, r := range []image.Rectangle{ycbcr.Bounds(), image.Rect(11, 7, 60, 90)} {
+		sub := ycbcr.SubImage(r).(*image.YCbCr)
+		integral := NewImage(r)
+		draw.Draw(integral, integral.Bounds(), sub, r.Min, draw.Src)
+		if l := NewFromYCbCrLuma(sub); !reflect.DeepEqual(*integral, *l) {
+			t.Errorf("Integral image of luma of %v differs to drawn integral image\n", r)
+		}
+	}
+}
+
+func TestFromGray(t *testing.T) {
+	gray := image.NewGray(image.Rect(4, 6, 24, 16))
+	draw.Draw(gray, gray.Bounds(), &image.Uniform{color.Gray{128}}, image.Point{}, draw.Src)
+	gray.SetGray(10, 10, color.Gray{255})
+
+	i := NewFromGray(gray)
+	if m := i.Mean(image.Rect(0, 0, 5, 4)); m != 128 {
+		t.Errorf("Mean wrong: expected 128, got %f\n", m)
+	}
+	if s := i.Sum(i.Bounds()); s != 128*199+255 {
+		t.Errorf("Sum wrong: expected %d, got %d\n", 128*199+255, s)
+	}
+
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	native := NewFromGray(img.(*image.Gray))
+	for _, r := range []image.Rectangle{b, image.Rect(10, 20, 50, 60)} {
+		if s, ns := integral.Sum(r), native.Sum(r); s != ns*257 {
+			t.Errorf("Sum of %v wrong: expected %d, got %d\n", r, s/257, ns)
+		}
+	}
+}
+
+func TestFromPaletted(t *testing.T) {
+	const ink = 1
+	img := image.NewPaletted(image.Rect(3, 2, 13, 12), color.Palette{color.White, color.Black})
+	for y := 4; y < 8; y++ {
+		for x := 5; x < 11; x++ {
+			img.SetColorIndex(x, y, ink)
+		}
+	}
+
+	i := NewFromPaletted(img, func(index uint8) uint16 {
+		if index == ink {
+			return 0xffff
+		}
+		return 0
+	})
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		ink  uint64
+	}{
+		{"fullimage", i.Bounds(), 24},
+		{"inkonly", image.Rect(2, 2, 8, 6), 24},
+		{"partial", image.Rect(0, 0, 4, 4), 4},
+		{"paper", image.Rect(0, 6, 10, 10), 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s := i.Sum(c.r); s != c.ink*0xffff {
+				t.Errorf("Sum wrong: expected %d, got %d\n", c.ink*0xffff, s)
+			}
+		})
+	}
+}
+
+func TestDiffImage(t *testing.T) {
+	b := image.Rect(0, 0, 8, 8)
+	a := image.NewGray16(b)
+	c := image.NewGray16(b)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			a.SetGray16(x, y, color.Gray16{20000})
+			v := uint16(20000)
+			if x >= 4 && y >= 4 {
+				v = 5000
+			}
+			c.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+
+	diff, err := NewDiffImage(a, c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		mean float64
+	}{
+		{"topleft", image.Rect(0, 0, 4, 4), 0},
+		{"topright", image.Rect(4, 0, 8, 4), 0},
+		{"bottomleft", image.Rect(0, 4, 4, 8), 0},
+		{"bottomright", image.Rect(4, 4, 8, 8), 15000},
+		{"fullimage", b, 15000 / 4.0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if m := diff.Mean(c.r); m != c.mean {
+				t.Errorf("Mean difference wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+
+	_, err = NewDiffImage(a, image.NewGray16(image.Rect(0, 0, 8, 9)))
+	if !errors.Is(err, ErrBoundsMismatch) {
+		t.Errorf("Expected bounds mismatch error, got %v\n", err)
+	}
+}
+
+func TestDeviationSq(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	mean := imgplus.mean(b)
+	var variance float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := float64(imgplus.Gray16At(x, y).Y) - mean
+			variance += d * d
+		}
+	}
+	variance /= float64(b.Dx() * b.Dy())
+
+	dev, m := NewDeviationSqImage(img)
+	if math.Abs(m-mean) > 1e-6 {
+		t.Errorf("Global mean wrong: expected %f, got %f\n", mean, m)
+	}
+	// each squared difference is rounded, so may be up to 0.5 out
+	if v := dev.Mean(b); math.Abs(v-variance) > 0.5 {
+		t.Errorf("Global variance wrong: expected %f, got %f\n", variance, v)
+	}
+
+	r := image.Rect(10, 10, 30, 30)
+	var local float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := float64(imgplus.Gray16At(x, y).Y) - mean
+			local += d * d
+		}
+	}
+	local /= float64(r.Dx() * r.Dy())
+	if v := dev.Mean(r); math.Abs(v-local) > 0.5 {
+		t.Errorf("Local deviation wrong: expected %f, got %f\n", local, v)
+	}
+}
+
+func TestFromImageWithRange(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 6, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			img.SetGray16(x, y, color.Gray16{uint16(30000 + x*100 + y*7)})
+		}
+	}
+	i, lo, hi := NewFromImageWithRange(img)
+	if lo != 30000 || hi != 30521 {
+		t.Errorf("Range wrong: expected 30000-30521, got %d-%d\n", lo, hi)
+	}
+	if !imgsequal(img, i) {
+		t.Errorf("Integral image differs to original\n")
+	}
+}
+
+func TestDownsampledFromImage(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	for _, factor := range []int{1, 2, 4, 5} {
+		t.Run(fmt.Sprintf("factor%d", factor), func(t *testing.T) {
+			small := NewDownsampledFromImage(img, factor)
+			if !imgsequal(integral.DownscaleMean(factor), small) {
+				t.Errorf("Downsampled image differs to downscaled full size image\n")
+			}
+
+			// 20 is divisible by each factor, so these sections of
+			// the two images cover the same pixels
+			r := image.Rect(20, 40, 60, 100)
+			sr := image.Rect(r.Min.X/factor, r.Min.Y/factor, r.Max.X/factor, r.Max.Y/factor)
+			if diff := math.Abs(small.Mean(sr) - integral.Mean(r)); diff > 0.5 {
+				t.Errorf("Mean wrong: expected %f, got %f\n", integral.Mean(r), small.Mean(sr))
+			}
+		})
+	}
+}
+
+func TestFromImageFunc(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	identity := NewFromImageFunc(img, func(gray uint16) uint64 { return uint64(gray) })
+	if !reflect.DeepEqual(*integral, *identity) {
+		t.Errorf("Integral image of identity function differs to drawn integral image\n")
+	}
+	square := NewFromImageFunc(img, func(gray uint16) uint64 { return uint64(gray) * uint64(gray) })
+	if !reflect.DeepEqual(Image(*sq), *square) {
+		t.Errorf("Integral image of square function differs to drawn square integral image\n")
+	}
+
+	midtones := NewFromImageFunc(img, func(gray uint16) uint64 {
+		if gray > 0x4000 && gray < 0xc000 {
+			return 1
+		}
+		return 0
+	})
+	g := grayValues(img)
+	var n uint64
+	for _, row := range g {
+		for _, v := range row {
+			if v > 0x4000 && v < 0xc000 {
+				n++
+			}
+		}
+	}
+	if s := midtones.Total(); s != n {
+		t.Errorf("Number of mid tone pixels wrong: expected %d, got %d\n", n, s)
+	}
+}
+
+func TestFromImageWithGray(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 3))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0xff, 0, 0, 0xff}), image.Point{}, draw.Src)
+
+	drawn := NewImage(img.Bounds())
+	draw.Draw(drawn, img.Bounds(), img, image.Point{}, draw.Src)
+
+	red := func(c color.Color) uint16 {
+		r, _, _, _ := c.RGBA()
+		return uint16(r)
+	}
+
+	cases := []struct {
+		name string
+		conv func(color.Color) uint16
+		mean float64
+	}{
+		{"luminance", Luminance, drawn.Mean(drawn.Bounds())},
+		{"average", Average, 0xffff / 3},
+		{"red", red, 0xffff},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			i := NewFromImageWithGray(img, c.conv)
+			if m := i.Mean(i.Bounds()); m != c.mean {
+				t.Errorf("Mean wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+
+	if l := NewFromImageWithGray(img, Luminance).Mean(img.Bounds()); l == 0xffff/3 {
+		t.Errorf("Luminance and average unexpectedly equal for pure red: %f\n", l)
+	}
+}
+
+func TestSaturating(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	s := NewFromImageSaturating(img, nil)
+	if s.Saturated() {
+		t.Errorf("Normal image reported as saturated\n")
+	}
+	if !reflect.DeepEqual(*integral, *s) {
+		t.Errorf("Saturating integral image differs to drawn integral image\n")
+	}
+
+	huge := NewFromImageSaturating(img, func(gray uint16) uint64 {
+		return 1 << 62
+	})
+	if !huge.Saturated() {
+		t.Errorf("Overflowing image not reported as saturated\n")
+	}
+	if v := huge.PrefixSumAt(2, 0); v != 3<<62 {
+		t.Errorf("Sum before overflow wrong: expected %d, got %d\n", uint64(3<<62), v)
+	}
+	if v := huge.PrefixSumAt(3, 0); v != math.MaxUint64 {
+		t.Errorf("Sum did not saturate: got %d\n", v)
+	}
+}
+
+func BenchmarkFromYCbCrLuma(b *testing.B) {
+	img := newYCbCrFromGray(image.NewGray(image.Rect(0, 0, 1920, 1080)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		NewFromYCbCrLuma(img)
+	}
+}
+
+func BenchmarkDrawYCbCr(b *testing.B) {
+	img := newYCbCrFromGray(image.NewGray(image.Rect(0, 0, 1920, 1080)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		integral := NewImage(img.Bounds())
+		draw.Draw(integral, img.Bounds(), img, image.Point{}, draw.Src)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+)
+
+// ErrUnsupportedOp is returned when drawing onto an integral image
+// with an operator other than draw.Src.
+var ErrUnsupportedOp = errors.New("integral: only draw.Src is supported")
+
+// DrawSrc draws src onto a section r of dst, as draw.Draw does, but
+// keeps every value of dst correct, including those below and to the
+// right of r, so that it can be used to draw over part of an integral
+// image which has already been drawn. Compositing operators like
+// draw.Over would need the original pixels to be reconstructed and
+// blended, so only draw.Src is supported, and any other op results in
+// ErrUnsupportedOp without dst being changed.
+//
+// As with draw.Draw, r is in the coordinate space of dst, and sp is
+// the point of src aligned with r.Min; r is clipped to the bounds of
+// both images.
+func DrawSrc(dst Image, r image.Rectangle, src image.Image, sp image.Point, op draw.Op) error {
+	if op != draw.Src {
+		return ErrUnsupportedOp
+	}
+
+	b := dst.Bounds()
+	min := r.Min
+	r = r.Intersect(b)
+	r = r.Intersect(src.Bounds().Add(min.Sub(sp)))
+	if r.Empty() {
+		return nil
+	}
+	sp = sp.Add(r.Min.Sub(min))
+
+	// Reconstruct the original pixels from the top left of r to the
+	// bottom right of the image, as every value there may change.
+	area := image.Rect(r.Min.X, r.Min.Y, b.Max.X, b.Max.Y)
+	orig := make([][]uint64, area.Dy())
+	for y := range orig {
+		orig[y] = make([]uint64, area.Dx())
+		for x := range orig[y] {
+			p := image.Pt(area.Min.X+x, area.Min.Y+y)
+			if p.In(r) {
+				s := sp.Add(p.Sub(r.Min))
+				orig[y][x] = uint64(gray16(src.At(s.X, s.Y)))
+				continue
+			}
+			orig[y][x] = dst.at64(p.X, p.Y)
+		}
+	}
+
+	for y, row := range orig {
+		for x, v := range row {
+			dst.set64(area.Min.X+x, area.Min.Y+y, v)
+		}
+	}
+	return nil
+}
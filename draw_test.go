@@ -0,0 +1,117 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawSrc(t *testing.T) {
+	b := image.Rect(0, 0, 20, 15)
+	ref := newGray16Plus(b)
+	integral := NewImage(b)
+
+	first := image.NewUniform(color.Gray16{30000})
+	second := image.NewGray16(image.Rect(100, 100, 110, 110))
+	for y := 100; y < 110; y++ {
+		for x := 100; x < 110; x++ {
+			second.SetGray16(x, y, color.Gray16{uint16(x*300 + y*7)})
+		}
+	}
+
+	draws := []struct {
+		r   image.Rectangle
+		src image.Image
+		sp  image.Point
+	}{
+		{image.Rect(2, 2, 12, 10), first, image.Point{}},
+		{image.Rect(8, 5, 30, 30), second, image.Pt(101, 102)},
+		{image.Rect(-3, -2, 5, 4), second, image.Pt(100, 100)},
+	}
+	for _, d := range draws {
+		draw.Draw(ref, d.r, d.src, d.sp, draw.Src)
+		err := DrawSrc(*integral, d.r, d.src, d.sp, draw.Src)
+		if err != nil {
+			t.Fatalf("Unexpected error drawing: %v\n", err)
+		}
+	}
+
+	if !imgsequal(ref, integral) {
+		t.Errorf("Integral image differs to regular image after overlapping draws\n")
+	}
+	for _, r := range []image.Rectangle{b, image.Rect(10, 10, 20, 15), image.Rect(0, 12, 20, 15), image.Rect(15, 0, 20, 4)} {
+		if integral.Sum(r) != ref.sum(r) {
+			t.Errorf("Sum of %v differs to regular image: regular: %d, integral: %d\n", r, ref.sum(r), integral.Sum(r))
+		}
+	}
+
+	before := integral.Total()
+	err := DrawSrc(*integral, b, first, image.Point{}, draw.Over)
+	if !errors.Is(err, ErrUnsupportedOp) {
+		t.Errorf("Expected unsupported op error drawing with draw.Over, got %v\n", err)
+	}
+	if integral.Total() != before {
+		t.Errorf("Image changed by unsupported draw\n")
+	}
+}
+
+func TestDrawPartial(t *testing.T) {
+	b := image.Rect(0, 0, 30, 25)
+	src := image.NewGray16(image.Rect(50, 60, 80, 90))
+	for y := 60; y < 90; y++ {
+		for x := 50; x < 80; x++ {
+			src.SetGray16(x, y, color.Gray16{uint16(x*500 + y*11)})
+		}
+	}
+
+	// draw part of src into the middle of each image
+	r := image.Rect(8, 6, 20, 15)
+	sp := image.Pt(55, 70)
+	ref := newGray16Plus(b)
+	draw.Draw(ref, r, src, sp, draw.Src)
+	drawn := NewImage(b)
+	draw.Draw(drawn, r, src, sp, draw.Src)
+	drawnSrc := NewImage(b)
+	if err := DrawSrc(*drawnSrc, r, src, sp, draw.Src); err != nil {
+		t.Fatalf("Unexpected error drawing: %v\n", err)
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		// whether the section extends below or to the right of the
+		// drawn area, so draw.Draw leaves it wrong
+		beyond bool
+	}{
+		{"drawn", r, false},
+		{"insideDrawn", image.Rect(10, 8, 15, 12), false},
+		{"aboveLeft", image.Rect(0, 0, 20, 15), false},
+		{"above", image.Rect(8, 0, 20, 10), false},
+		{"left", image.Rect(0, 6, 12, 15), false},
+		{"untouched", image.Rect(0, 0, 8, 6), false},
+		{"right", image.Rect(15, 6, 30, 15), true},
+		{"below", image.Rect(8, 10, 20, 25), true},
+		{"fullimage", b, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := ref.sum(c.r)
+			if s := drawnSrc.Sum(c.r); s != expected {
+				t.Errorf("Sum after DrawSrc wrong: expected %d, got %d\n", expected, s)
+			}
+			if c.beyond {
+				return
+			}
+			if s := drawn.Sum(c.r); s != expected {
+				t.Errorf("Sum after draw.Draw wrong: expected %d, got %d\n", expected, s)
+			}
+		})
+	}
+}
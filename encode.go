@@ -0,0 +1,304 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+)
+
+// gobImage is the form in which integral images are gob encoded.
+type gobImage struct {
+	Width, Height int
+	Values        []uint64
+}
+
+// GobEncode implements the gob.GobEncoder interface, so that
+// integral images can be saved and reloaded later, avoiding the need
+// to recompute them.
+func (i Image) GobEncode() ([]byte, error) {
+	var g gobImage
+	if len(i) > 0 && len(i[0]) > 0 {
+		g.Width, g.Height = len(i[0]), len(i)
+	}
+	g.Values = make([]uint64, 0, g.Width*g.Height)
+	for _, row := range i {
+		g.Values = append(g.Values, row...)
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(g)
+	return buf.Bytes(), err
+}
+
+// GobDecode implements the gob.GobDecoder interface.
+func (i *Image) GobDecode(data []byte) error {
+	var g gobImage
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g)
+	if err != nil {
+		return err
+	}
+	if !validGobDims(g.Width, g.Height, len(g.Values)) {
+		return errors.New("integral: invalid gob encoded image dimensions")
+	}
+
+	rows := make(Image, g.Height)
+	for y := range rows {
+		rows[y] = g.Values[y*g.Width : (y+1)*g.Width : (y+1)*g.Width]
+	}
+	*i = rows
+	return nil
+}
+
+// validGobDims returns whether n values fill an image of width by
+// height exactly. This is checked by division, as multiplying the
+// dimensions could overflow. An image with no values must have a
+// width and height of 0.
+func validGobDims(width, height, n int) bool {
+	if width == 0 || height == 0 {
+		return width == 0 && height == 0 && n == 0
+	}
+	return width > 0 && height > 0 && n%width == 0 && n/width == height
+}
+
+// GobEncode implements the gob.GobEncoder interface.
+func (i SqImage) GobEncode() ([]byte, error) {
+	return Image(i).GobEncode()
+}
+
+// GobDecode implements the gob.GobDecoder interface.
+func (i *SqImage) GobDecode(data []byte) error {
+	return (*Image)(i).GobDecode(data)
+}
+
+// statImage is the form in which StatImages are encoded.
+type statImage struct {
+	Image Image   `json:"image"`
+	Sq    SqImage `json:"sq"`
+}
+
+// decode sets s to the tables of e, returning an error if they have
+// different bounds.
+func (e statImage) decode(s *StatImage) error {
+	if !samePair(e.Image, e.Sq) {
+		return fmt.Errorf("%w: %v and %v", ErrBoundsMismatch, dims(e.Image), dims(Image(e.Sq)))
+	}
+	s.i, s.sq = e.Image, e.Sq
+	return nil
+}
+
+// GobEncode implements the gob.GobEncoder interface, encoding both
+// tables of the StatImage.
+func (s StatImage) GobEncode() ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(statImage{s.i, s.sq})
+	return buf.Bytes(), err
+}
+
+// GobDecode implements the gob.GobDecoder interface. An error
+// wrapping ErrBoundsMismatch is returned if the tables have different
+// bounds.
+func (s *StatImage) GobDecode(data []byte) error {
+	var e statImage
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	if err != nil {
+		return err
+	}
+	return e.decode(s)
+}
+
+// jsonImage is the form in which integral images are JSON encoded.
+type jsonImage struct {
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Data   [][]uint64 `json:"data"`
+}
+
+// MarshalJSON implements the json.Marshaler interface, encoding the
+// image as an object holding its width, height, and rows of values.
+// This is useful for debugging and for passing small integral images
+// to other programs, but as every value is written out as text it is
+// impractical for large images; GobEncode or WriteTo should be used
+// for those. Note also that many JSON decoders, such as JavaScript's,
+// hold numbers as float64, so cannot exactly represent values over
+// 2^53.
+func (i Image) MarshalJSON() ([]byte, error) {
+	j := jsonImage{Height: len(i), Data: [][]uint64(i)}
+	if j.Height > 0 {
+		j.Width = len(i[0])
+	}
+	if j.Data == nil {
+		j.Data = [][]uint64{}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (i *Image) UnmarshalJSON(data []byte) error {
+	var j jsonImage
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	if j.Width < 0 || len(j.Data) != j.Height {
+		return errors.New("integral: invalid JSON encoded image dimensions")
+	}
+	for _, row := range j.Data {
+		if len(row) != j.Width {
+			return errors.New("integral: invalid JSON encoded image dimensions")
+		}
+	}
+	*i = j.Data
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (i SqImage) MarshalJSON() ([]byte, error) {
+	return Image(i).MarshalJSON()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (i *SqImage) UnmarshalJSON(data []byte) error {
+	return (*Image)(i).UnmarshalJSON(data)
+}
+
+// binaryMagic identifies the binary serialization format.
+var binaryMagic = [4]byte{'I', 'N', 'T', 'G'}
+
+// binaryVersion is the current version of the binary serialization
+// format.
+const binaryVersion = 1
+
+// MarshalJSON implements the json.Marshaler interface, encoding the
+// StatImage as an object holding both of its tables, as "image" and
+// "sq".
+func (s StatImage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statImage{s.i, s.sq})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. An error
+// wrapping ErrBoundsMismatch is returned if the tables have different
+// bounds.
+func (s *StatImage) UnmarshalJSON(data []byte) error {
+	var e statImage
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return err
+	}
+	return e.decode(s)
+}
+
+// binaryHeader is the header of the binary serialization format.
+type binaryHeader struct {
+	Magic   [4]byte
+	Version uint32
+	Width   uint32
+	Height  uint32
+}
+
+// countWriter wraps an io.Writer, counting the bytes written to it.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo writes the image to w in a simple binary format, which is
+// straightforward to read from other languages, and returns the number
+// of bytes written. It implements the io.WriterTo interface.
+//
+// The format is a 16 byte header followed by the values of the image.
+// All numbers are little-endian. The header is the 4 bytes "INTG",
+// then the format version (currently 1), the width and the height,
+// each as a uint32. The values follow as a uint64 each, row by row
+// from the top, and left to right within each row.
+func (i Image) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	var b image.Rectangle
+	if len(i) > 0 && !i.Bounds().Empty() {
+		b = i.Bounds()
+	}
+	if uint64(b.Dx()) > math.MaxUint32 || uint64(b.Dy()) > math.MaxUint32 {
+		return 0, fmt.Errorf("integral: image of %dx%d is too large for binary format", b.Dx(), b.Dy())
+	}
+	h := binaryHeader{binaryMagic, binaryVersion, uint32(b.Dx()), uint32(b.Dy())}
+	err := binary.Write(bw, binary.LittleEndian, h)
+	if err != nil {
+		return cw.n, err
+	}
+	for _, row := range i {
+		err = binary.Write(bw, binary.LittleEndian, row)
+		if err != nil {
+			return cw.n, err
+		}
+	}
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// readChunk is the largest number of values which ReadImageFrom reads
+// at once, so that a corrupt header giving a huge size cannot make it
+// allocate far more memory than there is data to fill.
+const readChunk = 1 << 16
+
+// ReadImageFrom reads an image written by WriteTo from r. Memory is
+// only allocated as values are read, so a truncated or corrupt input
+// fails with an error wrapping io.ErrUnexpectedEOF, however large the
+// dimensions given in its header.
+func ReadImageFrom(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+	var h binaryHeader
+	err := binary.Read(br, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, fmt.Errorf("integral: error reading header: %w", err)
+	}
+	if h.Magic != binaryMagic {
+		return nil, errors.New("integral: not an integral image")
+	}
+	if h.Version != binaryVersion {
+		return nil, fmt.Errorf("integral: unsupported format version %d", h.Version)
+	}
+
+	if (h.Width == 0) != (h.Height == 0) {
+		return nil, fmt.Errorf("integral: invalid dimensions %dx%d", h.Width, h.Height)
+	}
+
+	w := int(h.Width)
+	chunk := make([]uint64, lowest(w, readChunk))
+	var rows Image
+	for y := 0; y < int(h.Height); y++ {
+		var row []uint64
+		if w <= readChunk {
+			row = make([]uint64, 0, w)
+		}
+		for len(row) < w {
+			c := chunk[:lowest(w-len(row), readChunk)]
+			err = binary.Read(br, binary.LittleEndian, c)
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return nil, fmt.Errorf("integral: error reading row %d: %w", y, err)
+			}
+			row = append(row, c...)
+		}
+		rows = append(rows, row)
+	}
+	return &rows, nil
+}
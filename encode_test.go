@@ -0,0 +1,256 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/png"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestGob(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err = enc.Encode(integral)
+	if err != nil {
+		t.Fatalf("Could not encode integral image: %v\n", err)
+	}
+	err = enc.Encode(sq)
+	if err != nil {
+		t.Fatalf("Could not encode square integral image: %v\n", err)
+	}
+
+	var integral2 Image
+	var sq2 SqImage
+	dec := gob.NewDecoder(&buf)
+	err = dec.Decode(&integral2)
+	if err != nil {
+		t.Fatalf("Could not decode integral image: %v\n", err)
+	}
+	err = dec.Decode(&sq2)
+	if err != nil {
+		t.Fatalf("Could not decode square integral image: %v\n", err)
+	}
+
+	if !integral2.Bounds().Eq(b) || !sq2.Bounds().Eq(b) {
+		t.Fatalf("Decoded bounds differ: expected %v, got %v and %v\n", b, integral2.Bounds(), sq2.Bounds())
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"middle", image.Rect(20, 30, 60, 90)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if integral.Sum(c.r) != integral2.Sum(c.r) {
+				t.Errorf("Sum of decoded integral image differs: original: %d, decoded: %d\n", integral.Sum(c.r), integral2.Sum(c.r))
+			}
+			if sq.Sum(c.r) != sq2.Sum(c.r) {
+				t.Errorf("Sum of decoded square integral image differs: original: %d, decoded: %d\n", sq.Sum(c.r), sq2.Sum(c.r))
+			}
+		})
+	}
+
+	invalid := []gobImage{
+		{Width: 2, Height: 3, Values: []uint64{1, 2, 3, 4}},
+		{Width: 3, Height: 1, Values: []uint64{1, 2, 3, 4}},
+		{Width: -2, Height: -2, Values: []uint64{1, 2, 3, 4}},
+		{Width: 0, Height: 4, Values: []uint64{}},
+		{Width: 1 << 32, Height: 1 << 32, Values: []uint64{}},
+	}
+	for _, g := range invalid {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(g); err != nil {
+			t.Fatalf("Could not encode gobImage: %v\n", err)
+		}
+		var i Image
+		if err := i.GobDecode(buf.Bytes()); err == nil {
+			t.Errorf("Expected error decoding %dx%d image with %d values\n", g.Width, g.Height, len(g.Values))
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	data, err := json.Marshal(integral)
+	if err != nil {
+		t.Fatalf("Could not encode integral image: %v\n", err)
+	}
+	sqdata, err := json.Marshal(sq)
+	if err != nil {
+		t.Fatalf("Could not encode square integral image: %v\n", err)
+	}
+
+	var integral2 Image
+	var sq2 SqImage
+	err = json.Unmarshal(data, &integral2)
+	if err != nil {
+		t.Fatalf("Could not decode integral image: %v\n", err)
+	}
+	err = json.Unmarshal(sqdata, &sq2)
+	if err != nil {
+		t.Fatalf("Could not decode square integral image: %v\n", err)
+	}
+
+	if !integral2.Bounds().Eq(b) || !sq2.Bounds().Eq(b) {
+		t.Fatalf("Decoded bounds differ: expected %v, got %v and %v\n", b, integral2.Bounds(), sq2.Bounds())
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"middle", image.Rect(20, 30, 60, 90)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if integral.Sum(c.r) != integral2.Sum(c.r) {
+				t.Errorf("Sum of decoded integral image differs: original: %d, decoded: %d\n", integral.Sum(c.r), integral2.Sum(c.r))
+			}
+			if sq.Sum(c.r) != sq2.Sum(c.r) {
+				t.Errorf("Sum of decoded square integral image differs: original: %d, decoded: %d\n", sq.Sum(c.r), sq2.Sum(c.r))
+			}
+		})
+	}
+
+	small := Image{{1, 3}, {4, 10}}
+	data, err = json.Marshal(small)
+	if err != nil {
+		t.Fatalf("Could not encode integral image: %v\n", err)
+	}
+	if expected := `{"width":2,"height":2,"data":[[1,3],[4,10]]}`; string(data) != expected {
+		t.Errorf("JSON encoding wrong: expected %s, got %s\n", expected, data)
+	}
+
+	invalid := []string{
+		`{"width":2,"height":3,"data":[[1,3],[4,10]]}`,
+		`{"width":3,"height":2,"data":[[1,3],[4,10]]}`,
+		`{"width":2,"height":2,"data":[[1,3],[4]]}`,
+		`[[1,3],[4,10]]`,
+	}
+	for _, s := range invalid {
+		var i Image
+		if err := json.Unmarshal([]byte(s), &i); err == nil {
+			t.Errorf("Expected error decoding %s\n", s)
+		}
+	}
+}
+
+func TestBinary(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	var buf bytes.Buffer
+	n, err := integral.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Could not write integral image: %v\n", err)
+	}
+	expected := int64(16 + 8*b.Dx()*b.Dy())
+	if n != expected || int64(buf.Len()) != expected {
+		t.Fatalf("Wrong number of bytes written: expected %d, reported %d, wrote %d\n", expected, n, buf.Len())
+	}
+	data := buf.Bytes()
+
+	integral2, err := ReadImageFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Could not read integral image: %v\n", err)
+	}
+	if !integral2.Bounds().Eq(b) {
+		t.Fatalf("Read bounds differ: expected %v, got %v\n", b, integral2.Bounds())
+	}
+	for _, r := range []image.Rectangle{b, image.Rect(1, 1, 5, 5), image.Rect(20, 30, 60, 90)} {
+		if integral.Sum(r) != integral2.Sum(r) {
+			t.Errorf("Sum of read integral image differs for %v: original: %d, read: %d\n", r, integral.Sum(r), integral2.Sum(r))
+		}
+	}
+
+	errcases := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", []byte{}},
+		{"shortheader", data[:10]},
+		{"truncated", data[:len(data)-3]},
+		{"headeronly", data[:16]},
+		{"badmagic", append([]byte("NOPE"), data[4:]...)},
+		{"zerowidth", append(append([]byte{}, data[:8]...), 0, 0, 0, 0, 1, 0, 0, 0)},
+	}
+
+	for _, c := range errcases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ReadImageFrom(bytes.NewReader(c.data))
+			if err == nil {
+				t.Errorf("Expected an error reading invalid data\n")
+			}
+		})
+	}
+
+	// a header claiming the largest possible image, followed by a
+	// little data, should fail without trying to allocate it all
+	huge := append(append([]byte{}, data[:8]...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+	huge = append(huge, data[16:1000]...)
+	if _, err := ReadImageFrom(bytes.NewReader(huge)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Reading huge truncated image gave wrong error: expected %v, got %v\n", io.ErrUnexpectedEOF, err)
+	}
+}
@@ -71,3 +71,20 @@ func ExampleMeanStdDev() {
 	// Output:
 	// Mean: 54677.229042, Standard Deviation: 21643.721672
 }
+
+func ExampleNewMeanStdDevPair() {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	in, sq := integral.NewMeanStdDevPair(img)
+	mean, stddev := integral.MeanStdDev(*in, *sq, img.Bounds())
+	fmt.Printf("Mean: %f, Standard Deviation: %f\n", mean, stddev)
+	// Output:
+	// Mean: 54677.229042, Standard Deviation: 21643.721672
+}
@@ -0,0 +1,414 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// centredWindow returns a square section of the given size, centred
+// on a point. For even sizes the point is just right of and below
+// the centre. Sizes of less than 1 are treated as 1, so the window
+// always contains the point.
+func centredWindow(x, y, size int) image.Rectangle {
+	size = highest(size, 1)
+	x0, y0 := x-size/2, y-size/2
+	return image.Rect(x0, y0, x0+size, y0+size)
+}
+
+// LocalContrastNormalize returns a grayscale copy of img where each
+// pixel is normalised by the mean and standard deviation of the
+// window of windowSize by windowSize pixels around it, as
+// (pixel - mean) / (stddev + eps). Windows are clamped to the bounds
+// of the image, and a windowSize of less than 1 is treated as 1.
+// Values are in the 16 bit grayscale range, so eps should be given in
+// that range too; it prevents division by zero in flat areas.
+//
+// The normalised values are stretched linearly to fill the 0-255
+// range of the output, from the lowest to the highest value in the
+// image. If every value is the same the output is mid gray.
+func LocalContrastNormalize(img image.Image, windowSize int, eps float64) *image.Gray {
+	b := img.Bounds()
+	s := NewStatImage(img)
+	g := grayValues(img)
+
+	norm := make([][]float64, b.Dy())
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for y := range norm {
+		norm[y] = make([]float64, b.Dx())
+		for x := range norm[y] {
+			mean, stddev := s.MeanStdDev(centredWindow(x, y, windowSize))
+			v := (float64(g[y][x]) - mean) / (stddev + eps)
+			norm[y][x] = v
+			lo = math.Min(lo, v)
+			hi = math.Max(hi, v)
+		}
+	}
+
+	out := image.NewGray(b)
+	for y, row := range norm {
+		for x, v := range row {
+			c := uint8(128)
+			if hi > lo {
+				c = uint8(math.Round((v - lo) / (hi - lo) * 255))
+			}
+			out.SetGray(b.Min.X+x, b.Min.Y+y, color.Gray{c})
+		}
+	}
+	return out
+}
+
+// boxSizes returns the widths of n box filters which, applied in
+// turn, approximate a Gaussian blur with standard deviation sigma.
+func boxSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	wl := int(math.Floor(ideal))
+	if wl%2 == 0 {
+		wl--
+	}
+	wu := wl + 2
+	fn, fwl := float64(n), float64(wl)
+	m := int(math.Round((12*sigma*sigma - fn*fwl*fwl - 4*fn*fwl - 3*fn) / (-4*fwl - 4)))
+
+	sizes := make([]int, n)
+	for i := range sizes {
+		sizes[i] = wu
+		if i < m {
+			sizes[i] = wl
+		}
+	}
+	return sizes
+}
+
+// GaussianApprox returns a copy of img blurred with an approximation
+// of a Gaussian blur, made by applying three box blurs in turn, each
+// of which takes constant time per pixel using an integral image.
+// Box blurs are clamped to the bounds of the image at the edges.
+//
+// The widths of the boxes are chosen so that the variance of the
+// three together matches sigma². Each width w contributes a variance
+// of (w² - 1) / 12, so the ideal width for three equal boxes is
+// √(12σ²/3 + 1); as widths must be odd, some boxes use the odd width
+// just below this and the rest the one just above, in the proportion
+// which gives the closest total variance.
+func GaussianApprox(img image.Image, sigma float64) *image.Gray16 {
+	b := img.Bounds()
+	g := grayValues(img)
+	for _, size := range boxSizes(sigma, 3) {
+		i := newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+			return uint64(g[y][x])
+		})
+		for y, row := range g {
+			for x := range row {
+				row[x] = uint16(math.Round(i.Mean(centredWindow(x, y, size))))
+			}
+		}
+	}
+
+	out := image.NewGray16(b)
+	for y, row := range g {
+		for x, v := range row {
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{v})
+		}
+	}
+	return out
+}
+
+// BoxDoG returns a blob response map of img, approximating a
+// Difference of Gaussians with box filters. Each pixel is the mean of
+// the box of innerRadius around it less the mean of the larger box of
+// outerRadius around it, where a box of radius r is 2r+1 pixels wide.
+// Boxes are clamped to the bounds of the image.
+//
+// As the difference can be negative, it is halved and offset so that
+// no difference is mid gray (0x8000); spots brighter than their
+// surroundings are lighter than this, and darker spots are darker.
+func BoxDoG(img image.Image, innerRadius, outerRadius int) *image.Gray16 {
+	b := img.Bounds()
+	i := fromImage(img)
+
+	out := image.NewGray16(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			inner := i.Mean(centredWindow(x, y, 2*innerRadius+1))
+			outer := i.Mean(centredWindow(x, y, 2*outerRadius+1))
+			v := math.Round(0x8000 + (inner-outer)/2)
+			v = math.Max(0, math.Min(v, 0xffff))
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{uint16(v)})
+		}
+	}
+	return out
+}
+
+// ContrastStretch returns a grayscale copy of img with its values
+// stretched linearly so that the darkest pixel is black and the
+// lightest white. If every pixel is the same the copy is unchanged.
+func ContrastStretch(img image.Image) *image.Gray16 {
+	b := img.Bounds()
+	i, lo, hi := NewFromImageWithRange(img)
+	o := i.Original()
+	out := image.NewGray16(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			v := o.Gray16At(x, y).Y
+			if hi > lo {
+				v = uint16((uint64(v-lo)*0xffff + uint64(hi-lo)/2) / uint64(hi-lo))
+			}
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{v})
+		}
+	}
+	return out
+}
+
+// DownscaleMean returns a copy of the original image shrunk by the
+// given factor, with each pixel being the mean of the corresponding
+// factor by factor block of the original. If the size of the image is
+// not divisible by factor, the last blocks in each direction are
+// smaller, covering only the remaining pixels. A factor of less than
+// 1 is treated as 1.
+func (i Image) DownscaleMean(factor int) *image.Gray16 {
+	factor = highest(factor, 1)
+	b := i.Bounds()
+	w := (b.Dx() + factor - 1) / factor
+	h := (b.Dy() + factor - 1) / factor
+	out := image.NewGray16(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r := image.Rect(x*factor, y*factor, (x+1)*factor, (y+1)*factor)
+			out.SetGray16(x, y, color.Gray16{uint16(math.Round(i.Mean(r)))})
+		}
+	}
+	return out
+}
+
+// MeanGrid divides the image into a grid of cols by rows tiles and
+// returns the mean of each, in order from top to bottom and left to
+// right. Where the size of the image is not divisible by the grid,
+// the tiles differ in size by up to one pixel. cols and rows are
+// clamped to the width and height of the image, so that every tile has
+// at least one pixel, in which case fewer than cols*rows means are
+// returned. The results are stored in out, which is reused if it has
+// enough capacity, so that the same slice can be passed in repeatedly
+// without allocating.
+func (i Image) MeanGrid(cols, rows int, out []float64) []float64 {
+	b := i.Bounds()
+	cols, rows = lowest(cols, b.Dx()), lowest(rows, b.Dy())
+	out = out[:0]
+	for r := 0; r < rows; r++ {
+		y0, y1 := r*b.Dy()/rows, (r+1)*b.Dy()/rows
+		for c := 0; c < cols; c++ {
+			x0, x1 := c*b.Dx()/cols, (c+1)*b.Dx()/cols
+			out = append(out, i.Mean(image.Rect(x0, y0, x1, y1)))
+		}
+	}
+	return out
+}
+
+// TileMeans divides the image into tiles of tileW by tileH pixels and
+// returns the mean of each, indexed as [y][x] by the position of the
+// tile. If the size of the image is not divisible by the tile size,
+// the last tiles in each direction are smaller, covering only the
+// remaining pixels. Tile sizes of less than 1 are treated as 1.
+//
+// Rather than looking up the four corners of each tile separately,
+// the values on the bottom edge of each row of tiles are read once,
+// and the sums of the band of the image between that and the row of
+// tiles above are found for each tile boundary in turn, from which
+// each tile's sum is a single subtraction.
+func (i Image) TileMeans(tileW, tileH int) [][]float64 {
+	tileW, tileH = highest(tileW, 1), highest(tileH, 1)
+	b := i.Bounds()
+	cols := (b.Dx() + tileW - 1) / tileW
+	rows := (b.Dy() + tileH - 1) / tileH
+
+	// the x coordinate of the last pixel of each column of tiles
+	edges := make([]int, cols)
+	for c := range edges {
+		edges[c] = lowest((c+1)*tileW, b.Dx()) - 1
+	}
+
+	means := make([][]float64, rows)
+	prev := make([]uint64, cols)
+	band := make([]uint64, cols)
+	for r := range means {
+		y0, y1 := r*tileH, lowest((r+1)*tileH, b.Dy())
+		row := i[y1-1]
+		for c, x := range edges {
+			v := row[x]
+			band[c] = v - prev[c]
+			prev[c] = v
+		}
+
+		means[r] = make([]float64, cols)
+		var left uint64
+		for c, sum := range band {
+			w := edges[c] + 1 - c*tileW
+			means[r][c] = float64(sum-left) / float64(w*(y1-y0))
+			left = sum
+		}
+	}
+	return means
+}
+
+// SlidingMean calls fn for every pixel of the image, in order from
+// top to bottom and left to right, with the mean of the windowSize by
+// windowSize window around it, clamped to the bounds of the image.
+// This allows per-pixel processing of local means without needing to
+// allocate a whole image to hold them.
+func (i Image) SlidingMean(windowSize int, fn func(x, y int, mean float64)) {
+	b := i.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			fn(x, y, i.Mean(centredWindow(x, y, windowSize)))
+		}
+	}
+}
+
+// ExtremeWindow finds the windowSize by windowSize window within the
+// image with the highest mean, or the lowest if findMax is false, for
+// example to find the brightest area or the one most dense with ink.
+// It returns the top left point of the window and its mean. Only
+// windows entirely within the image are considered; if windowSize is
+// larger than the image in either direction, the window is shrunk to
+// fit in that direction. Where several windows have the same mean,
+// the first found, in order from top to bottom and left to right, is
+// returned.
+func (i Image) ExtremeWindow(windowSize int, findMax bool) (image.Point, float64) {
+	b := i.Bounds()
+	windowSize = highest(windowSize, 1)
+	w, h := lowest(windowSize, b.Dx()), lowest(windowSize, b.Dy())
+
+	var best image.Point
+	var bestSum uint64
+	for y := 0; y+h <= b.Dy(); y++ {
+		for x := 0; x+w <= b.Dx(); x++ {
+			sum := i.sumIn(image.Rect(x, y, x+w, y+h))
+			if (x == 0 && y == 0) || (findMax && sum > bestSum) || (!findMax && sum < bestSum) {
+				best, bestSum = image.Pt(x, y), sum
+			}
+		}
+	}
+	return best, float64(bestSum) / float64(w*h)
+}
+
+// LocalRange returns a map of the local range of img, where each
+// pixel is the difference between the highest and lowest 16 bit
+// grayscale values in the windowSize by windowSize window around it.
+// Windows are clamped to the bounds of the image. Areas where the
+// range collapses, such as patches of glare which are uniformly
+// bright, are dark in the result.
+//
+// The minimum and maximum cannot be found with an integral image, so
+// unlike most of this package this does not use one. Instead each is
+// found exactly with a sliding window over each row and then each
+// column, keeping a queue of the values which could still become the
+// extreme, which takes constant time per pixel on average whatever
+// the size of the window.
+func LocalRange(img image.Image, windowSize int) *image.Gray16 {
+	windowSize = highest(windowSize, 1)
+	b := img.Bounds()
+	g := grayValues(img)
+	hi := slidingExtreme2D(g, windowSize, func(a, b uint16) bool { return a > b })
+	lo := slidingExtreme2D(g, windowSize, func(a, b uint16) bool { return a < b })
+
+	out := image.NewGray16(b)
+	for y := range g {
+		for x := range g[y] {
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{hi[y][x] - lo[y][x]})
+		}
+	}
+	return out
+}
+
+// slidingExtreme2D returns the most extreme value, according to
+// better, of the size by size window around each value of v, indexed
+// as [y][x]. The extremes of each row are found first, and then the
+// extremes of each column of those.
+func slidingExtreme2D(v [][]uint16, size int, better func(a, b uint16) bool) [][]uint16 {
+	rows := make([][]uint16, len(v))
+	for y, row := range v {
+		rows[y] = slidingExtreme(row, size, better)
+	}
+	if len(rows) == 0 {
+		return rows
+	}
+	col := make([]uint16, len(rows))
+	for x := range rows[0] {
+		for y := range rows {
+			col[y] = rows[y][x]
+		}
+		for y, e := range slidingExtreme(col, size, better) {
+			rows[y][x] = e
+		}
+	}
+	return rows
+}
+
+// slidingExtreme returns the most extreme value, according to better,
+// of the window of size values around each value of v, clamped to the
+// ends of v. A queue is kept of the positions of values which could
+// be the extreme of the current or a later window, which are those
+// that no later value in the window is better than or equal to; so
+// the front of the queue is always the extreme of the window.
+func slidingExtreme(v []uint16, size int, better func(a, b uint16) bool) []uint16 {
+	out := make([]uint16, len(v))
+	var queue []int
+	next := 0
+	for i := range v {
+		lo, hi := i-size/2, i-size/2+size
+		for ; next < hi && next < len(v); next++ {
+			for len(queue) > 0 && !better(v[queue[len(queue)-1]], v[next]) {
+				queue = queue[:len(queue)-1]
+			}
+			queue = append(queue, next)
+		}
+		for queue[0] < lo {
+			queue = queue[1:]
+		}
+		out[i] = v[queue[0]]
+	}
+	return out
+}
+
+// AdaptiveGamma returns a grayscale copy of img with a gamma
+// correction applied to each pixel which depends on the mean of the
+// windowSize by windowSize window around it, to even out uneven
+// illumination. Windows are clamped to the bounds of the image.
+//
+// With values normalised to the range 0-1, a window with mean m in an
+// image with mean M is given the gamma log(M)/log(m), which maps m to
+// M, so that bright areas are darkened and dark areas brightened
+// towards the mean of the whole image. This gamma is raised to the
+// power of strength, so a strength of 1 gives the full correction, 0
+// none at all, and values in between a partial correction. If the
+// image is entirely black or white it is returned unchanged.
+func AdaptiveGamma(img image.Image, windowSize int, strength float64) *image.Gray16 {
+	b := img.Bounds()
+	i := fromImage(img)
+	g := grayValues(img)
+
+	// means of 0 and 1 have no useful gamma, so are kept just within
+	// the range
+	unit := func(v float64) float64 {
+		return math.Max(1.0/0xffff, math.Min(v/0xffff, 1-1.0/0xffff))
+	}
+	global := i.Mean(i.Bounds()) / 0xffff
+	flat := global == 0 || global == 1
+
+	out := image.NewGray16(b)
+	for y, row := range g {
+		for x, v := range row {
+			if !flat {
+				m := unit(i.Mean(centredWindow(x, y, windowSize)))
+				gamma := math.Pow(math.Log(unit(global*0xffff))/math.Log(m), strength)
+				v = clampGray16(math.Pow(float64(v)/0xffff, gamma) * 0xffff)
+			}
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{v})
+		}
+	}
+	return out
+}
@@ -0,0 +1,535 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLocalContrastNormalize(t *testing.T) {
+	img := image.NewGray(image.Rect(10, 10, 30, 30))
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			img.SetGray(x, y, color.Gray{100})
+		}
+	}
+	img.SetGray(20, 20, color.Gray{200})
+	img.SetGray(12, 25, color.Gray{20})
+
+	out := LocalContrastNormalize(img, 5, 1)
+	if !out.Bounds().Eq(img.Bounds()) {
+		t.Fatalf("Output bounds differ: expected %v, got %v\n", img.Bounds(), out.Bounds())
+	}
+
+	cases := []struct {
+		name string
+		p    image.Point
+		min  uint8
+		max  uint8
+	}{
+		{"bright", image.Pt(20, 20), 255, 255},
+		{"dark", image.Pt(12, 25), 0, 0},
+		{"flat", image.Pt(15, 15), 100, 160},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := out.GrayAt(c.p.X, c.p.Y).Y
+			if v < c.min || v > c.max {
+				t.Errorf("Normalised value %d outside of expected range %d - %d\n", v, c.min, c.max)
+			}
+		})
+	}
+
+	flat := LocalContrastNormalize(image.NewGray(image.Rect(0, 0, 4, 4)), 3, 1)
+	if v := flat.GrayAt(1, 1).Y; v != 128 {
+		t.Errorf("Normalised value of flat image wrong: expected 128, got %d\n", v)
+	}
+
+	for _, size := range []int{0, -3} {
+		if !reflect.DeepEqual(LocalContrastNormalize(img, size, 1), LocalContrastNormalize(img, 1, 1)) {
+			t.Errorf("Normalised image with window size %d differs to window size 1\n", size)
+		}
+	}
+}
+
+// gaussian returns img blurred with a separable Gaussian kernel,
+// renormalised where the kernel extends beyond the image.
+func gaussian(img image.Image, sigma float64) [][]float64 {
+	g := grayValues(img)
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	for k := range kernel {
+		d := float64(k - radius)
+		kernel[k] = math.Exp(-d * d / (2 * sigma * sigma))
+	}
+	h, w := len(g), len(g[0])
+
+	pass := func(get func(x, y int) float64, dx, dy int) [][]float64 {
+		out := make([][]float64, h)
+		for y := range out {
+			out[y] = make([]float64, w)
+			for x := range out[y] {
+				var sum, weight float64
+				for k, kv := range kernel {
+					sx, sy := x+(k-radius)*dx, y+(k-radius)*dy
+					if sx < 0 || sy < 0 || sx >= w || sy >= h {
+						continue
+					}
+					sum += get(sx, sy) * kv
+					weight += kv
+				}
+				out[y][x] = sum / weight
+			}
+		}
+		return out
+	}
+
+	horiz := pass(func(x, y int) float64 { return float64(g[y][x]) }, 1, 0)
+	return pass(func(x, y int) float64 { return horiz[y][x] }, 0, 1)
+}
+
+func TestGaussianApprox(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	for _, sigma := range []float64{1, 2.5, 4} {
+		t.Run(fmt.Sprintf("sigma%.1f", sigma), func(t *testing.T) {
+			out := GaussianApprox(img, sigma)
+			if !out.Bounds().Eq(b) {
+				t.Fatalf("Output bounds differ: expected %v, got %v\n", b, out.Bounds())
+			}
+			ref := gaussian(img, sigma)
+
+			var diff float64
+			var n int
+			margin := int(3 * sigma)
+			for y := margin; y < b.Dy()-margin; y++ {
+				for x := margin; x < b.Dx()-margin; x++ {
+					diff += math.Abs(float64(out.Gray16At(x, y).Y) - ref[y][x])
+					n++
+				}
+			}
+			diff /= float64(n)
+			if diff > 0.01*0xffff {
+				t.Errorf("Mean difference from Gaussian blur too high: %f\n", diff)
+			}
+		})
+	}
+}
+
+func TestDownscaleMean(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	small := integral.DownscaleMean(4)
+	// 94x117 doesn't divide by 4, so the last blocks are partial
+	if !small.Bounds().Eq(image.Rect(0, 0, 24, 30)) {
+		t.Fatalf("Downscaled bounds wrong: %v\n", small.Bounds())
+	}
+
+	for _, p := range []image.Point{{0, 0}, {5, 7}, {23, 10}, {10, 29}, {23, 29}} {
+		r := image.Rect(p.X*4, p.Y*4, p.X*4+4, p.Y*4+4)
+		expected := uint16(math.Round(imgplus.mean(r)))
+		if v := small.Gray16At(p.X, p.Y).Y; v != expected {
+			t.Errorf("Downscaled pixel %v wrong: expected %d, got %d\n", p, expected, v)
+		}
+	}
+
+	same := integral.DownscaleMean(1)
+	if !imgsequal(same, integral) {
+		t.Errorf("Downscaling by 1 differs to original image\n")
+	}
+}
+
+func TestSlidingMean(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	const size = 9
+	means := make([][]float64, b.Dy())
+	for y := range means {
+		means[y] = make([]float64, b.Dx())
+	}
+	calls := 0
+	integral.SlidingMean(size, func(x, y int, mean float64) {
+		means[y][x] = mean
+		calls++
+	})
+
+	if calls != b.Dx()*b.Dy() {
+		t.Fatalf("Wrong number of calls: expected %d, got %d\n", b.Dx()*b.Dy(), calls)
+	}
+	for y, row := range means {
+		for x, mean := range row {
+			r := image.Rect(x-size/2, y-size/2, x-size/2+size, y-size/2+size)
+			if expected := imgplus.mean(r); mean != expected {
+				t.Fatalf("Sliding mean at %d,%d wrong: expected %f, got %f\n", x, y, expected, mean)
+			}
+		}
+	}
+}
+
+func TestBoxDoG(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 21, 21))
+	draw.Draw(img, image.Rect(9, 9, 12, 12), image.White, image.Point{}, draw.Src)
+	dog := BoxDoG(img, 1, 5)
+
+	cases := []struct {
+		name     string
+		x, y     int
+		expected uint16
+	}{
+		{"spot", 10, 10, uint16(math.Round(0x8000 + (0xffff-0xffff*9.0/121)/2))},
+		{"background", 0, 0, 0x8000},
+		{"edge", 20, 10, 0x8000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := dog.Gray16At(c.x, c.y).Y
+			if got != c.expected {
+				t.Errorf("BoxDoG wrong: expected %v, got %v\n", c.expected, got)
+			}
+		})
+	}
+
+	b := dog.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if v := dog.Gray16At(x, y).Y; v > dog.Gray16At(10, 10).Y {
+				t.Errorf("BoxDoG response at %d,%d of %v is stronger than at the spot\n", x, y, v)
+			}
+		}
+	}
+}
+
+func TestMeanGrid(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		cols, rows int
+	}{
+		{1, 1},
+		{2, 2},
+		{4, 3},
+		{7, 5},
+	}
+
+	var out []float64
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%dx%d", c.cols, c.rows), func(t *testing.T) {
+			out = integral.MeanGrid(c.cols, c.rows, out)
+			if len(out) != c.cols*c.rows {
+				t.Fatalf("Number of means wrong: expected %d, got %d\n", c.cols*c.rows, len(out))
+			}
+			for r := 0; r < c.rows; r++ {
+				for col := 0; col < c.cols; col++ {
+					tile := image.Rect(col*b.Dx()/c.cols, r*b.Dy()/c.rows, (col+1)*b.Dx()/c.cols, (r+1)*b.Dy()/c.rows)
+					expected := imgplus.mean(tile)
+					if got := out[r*c.cols+col]; math.Abs(got-expected) > 1e-6 {
+						t.Errorf("Mean of tile %v wrong: expected %f, got %f\n", tile, expected, got)
+					}
+				}
+			}
+		})
+	}
+
+	buf := make([]float64, 0, 64)
+	out = integral.MeanGrid(4, 4, buf)
+	if &out[0] != &buf[:1][0] {
+		t.Errorf("MeanGrid did not reuse the provided buffer\n")
+	}
+
+	small := newFromValues(3, 2, func(x, y int) uint64 { return uint64(x + y*3) })
+	out = small.MeanGrid(10, 5, nil)
+	if len(out) != 6 {
+		t.Fatalf("Number of means of grid larger than image wrong: expected %d, got %d\n", 6, len(out))
+	}
+	for n, m := range out {
+		if m != float64(n) {
+			t.Errorf("Mean of tile %d of grid larger than image wrong: expected %d, got %f\n", n, n, m)
+		}
+	}
+}
+
+func TestContrastStretch(t *testing.T) {
+	img := image.NewGray16(image.Rect(2, 3, 12, 8))
+	for y := 3; y < 8; y++ {
+		for x := 2; x < 12; x++ {
+			img.SetGray16(x, y, color.Gray16{uint16(30000 + x*100)})
+		}
+	}
+	stretched := ContrastStretch(img)
+
+	cases := []struct {
+		name     string
+		x, y     int
+		expected uint16
+	}{
+		{"darkest", 2, 3, 0},
+		{"lightest", 11, 7, 0xffff},
+		{"middle", 7, 5, uint16(math.Round(500.0 / 900 * 0xffff))},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := stretched.Gray16At(c.x, c.y).Y; v != c.expected {
+				t.Errorf("Stretched value wrong: expected %d, got %d\n", c.expected, v)
+			}
+		})
+	}
+
+	flat := image.NewGray16(image.Rect(0, 0, 4, 4))
+	draw.Draw(flat, flat.Bounds(), &image.Uniform{color.Gray16{1234}}, image.Point{}, draw.Src)
+	if !imgsequal(flat, ContrastStretch(flat)) {
+		t.Errorf("Stretching a flat image changed it\n")
+	}
+}
+
+func TestExtremeWindow(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 40, 30))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray16{20000}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(25, 12, 30, 17), &image.Uniform{color.Gray16{60000}}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(3, 20, 8, 25), &image.Uniform{color.Gray16{1000}}, image.Point{}, draw.Src)
+	i := fromImage(img)
+
+	cases := []struct {
+		name    string
+		size    int
+		findMax bool
+		point   image.Point
+		mean    float64
+	}{
+		{"brightest", 5, true, image.Pt(25, 12), 60000},
+		{"darkest", 5, false, image.Pt(3, 20), 1000},
+		{"brightestLarger", 7, true, image.Pt(23, 10), (25*60000 + 24*20000) / 49.0},
+		{"single", 1, true, image.Pt(25, 12), 60000},
+		{"wholeImage", 100, true, image.Pt(0, 0), i.Mean(img.Bounds())},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, mean := i.ExtremeWindow(c.size, c.findMax)
+			if !p.Eq(c.point) {
+				t.Errorf("Point wrong: expected %v, got %v\n", c.point, p)
+			}
+			if math.Abs(mean-c.mean) > 1e-6 {
+				t.Errorf("Mean wrong: expected %f, got %f\n", c.mean, mean)
+			}
+		})
+	}
+}
+
+func TestLocalRange(t *testing.T) {
+	// a textured page with a patch of glare
+	img := image.NewGray16(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			v := uint16(20000 + (x*7+y*13)%10*1000)
+			if x >= 20 && x < 35 && y >= 5 && y < 20 {
+				v = 0xffff
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+	g := grayValues(img)
+
+	for _, size := range []int{1, 4, 5} {
+		lr := LocalRange(img, size)
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				r := centredWindow(x, y, size).Intersect(img.Bounds())
+				lo, hi := uint16(0xffff), uint16(0)
+				for wy := r.Min.Y; wy < r.Max.Y; wy++ {
+					for wx := r.Min.X; wx < r.Max.X; wx++ {
+						if g[wy][wx] < lo {
+							lo = g[wy][wx]
+						}
+						if g[wy][wx] > hi {
+							hi = g[wy][wx]
+						}
+					}
+				}
+				if v := lr.Gray16At(x, y).Y; v != hi-lo {
+					t.Fatalf("Range at %d,%d with size %d wrong: expected %d, got %d\n", x, y, size, hi-lo, v)
+				}
+			}
+		}
+	}
+
+	lr := LocalRange(img, 5)
+	if v := lr.Gray16At(27, 12).Y; v != 0 {
+		t.Errorf("Range in glare wrong: expected 0, got %d\n", v)
+	}
+	if v := lr.Gray16At(8, 25).Y; v < 5000 {
+		t.Errorf("Range in textured area too low: %d\n", v)
+	}
+}
+
+func TestAdaptiveGamma(t *testing.T) {
+	// a page lit much more brightly on the right than the left
+	img := image.NewGray16(image.Rect(0, 0, 50, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 50; x++ {
+			v := 8000 + x*1100
+			if (x+y)%5 == 0 {
+				v /= 2
+			}
+			img.SetGray16(x, y, color.Gray16{uint16(v)})
+		}
+	}
+
+	// the range of the means of vertical strips measures how even
+	// the illumination is
+	spread := func(img image.Image) float64 {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, m := range fromImage(img).MeanGrid(10, 1, nil) {
+			lo, hi = math.Min(lo, m), math.Max(hi, m)
+		}
+		return hi - lo
+	}
+
+	corrected := AdaptiveGamma(img, 9, 1)
+	if before, after := spread(img), spread(corrected); after > before/4 {
+		t.Errorf("Corrected image not much more uniform: range before %f, after %f\n", before, after)
+	}
+	partial := AdaptiveGamma(img, 9, 0.5)
+	if before, after := spread(img), spread(partial); after > before || after < spread(corrected) {
+		t.Errorf("Partly corrected image range not between the original and fully corrected: %f\n", after)
+	}
+
+	if !imgsequal(img, AdaptiveGamma(img, 9, 0)) {
+		t.Errorf("Correction with strength 0 changed image\n")
+	}
+
+	black := image.NewGray16(image.Rect(0, 0, 5, 5))
+	if !imgsequal(black, AdaptiveGamma(black, 3, 1)) {
+		t.Errorf("Correction of black image changed it\n")
+	}
+}
+
+func TestTileMeans(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		w, h int
+	}{
+		{1, 1},
+		{8, 8},
+		{10, 13},
+		{16, 5},
+		{94, 117},
+		{200, 200},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("%dx%d", c.w, c.h), func(t *testing.T) {
+			means := integral.TileMeans(c.w, c.h)
+			rows, cols := (b.Dy()+c.h-1)/c.h, (b.Dx()+c.w-1)/c.w
+			if len(means) != rows || len(means[0]) != cols {
+				t.Fatalf("Number of tiles wrong: expected %dx%d, got %dx%d\n", cols, rows, len(means[0]), len(means))
+			}
+			for y, row := range means {
+				for x, m := range row {
+					r := image.Rect(x*c.w, y*c.h, (x+1)*c.w, (y+1)*c.h)
+					if expected := integral.Mean(r); m != expected {
+						t.Errorf("Mean of tile %v wrong: expected %f, got %f\n", r, expected, m)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTileMeans(b *testing.B) {
+	i := newFromValues(3840, 2160, func(x, y int) uint64 { return uint64(x ^ y) })
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		i.TileMeans(64, 64)
+	}
+}
+
+func BenchmarkTileMeansSeparate(b *testing.B) {
+	i := newFromValues(3840, 2160, func(x, y int) uint64 { return uint64(x ^ y) })
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		means := make([][]float64, (2160+63)/64)
+		for y := range means {
+			means[y] = make([]float64, 3840/64)
+			for x := range means[y] {
+				means[y][x] = i.Mean(image.Rect(x*64, y*64, (x+1)*64, (y+1)*64))
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// FloatImage is an integral image of float64 values. It is useful
+// for source data which is not an image as such, like feature maps,
+// whose values would be quantized or clipped by conversion to 16 bit
+// grayscale.
+type FloatImage [][]float64
+
+// Float is a colour holding a single float64 value, which can be
+// used to draw high dynamic range data onto a FloatImage without it
+// being clipped to 16 bit grayscale. Wrapping such data in an
+// image.Image whose At method returns Floats allows it to be drawn
+// with draw.Draw and draw.Src, in the same way as regular images are
+// drawn onto an Image.
+type Float struct {
+	Y float64
+}
+
+// RGBA returns the value as a 16 bit gray, clamped to the 0-0xffff
+// range, so that a Float can be used like any other colour.
+func (c Float) RGBA() (r, g, b, a uint32) {
+	return color.Gray16{clampGray16(c.Y)}.RGBA()
+}
+
+// FloatModel converts colours to Float, with colours that are not
+// already Floats converted via 16 bit grayscale.
+var FloatModel color.Model = color.ModelFunc(floatModel)
+
+func floatModel(c color.Color) color.Color {
+	if f, ok := c.(Float); ok {
+		return f
+	}
+	return Float{float64(gray16(c))}
+}
+
+// FloatSqImage is a Square integral image of float64 values.
+type FloatSqImage [][]float64
+
+// NewFloatImage returns a new float integral image with the given
+// bounds.
+func NewFloatImage(r image.Rectangle) *FloatImage {
+	w, h := r.Dx(), r.Dy()
+	var rows FloatImage
+	for i := 0; i < h; i++ {
+		col := make([]float64, w)
+		rows = append(rows, col)
+	}
+	return &rows
+}
+
+// NewFloatSqImage returns a new float squared integral image with
+// the given bounds.
+func NewFloatSqImage(r image.Rectangle) *FloatSqImage {
+	i := NewFloatImage(r)
+	s := FloatSqImage(*i)
+	return &s
+}
+
+func (i FloatImage) Bounds() image.Rectangle {
+	return GenericImage[float64](i).Bounds()
+}
+
+func (i FloatImage) ColorModel() color.Model { return FloatModel }
+
+func (i FloatImage) At(x, y int) color.Color {
+	return Float{i.orig(x, y)}
+}
+
+// Set sets the pixel at a point. Float colours are used as they are,
+// without losing precision, and other colours are converted to 16 bit
+// grayscale. As with Image.Set, pixels must be set in order, from top
+// to bottom and left to right, and each only once, as happens when
+// drawing a whole image onto a new FloatImage with draw.Draw and
+// draw.Src.
+func (i FloatImage) Set(x, y int, c color.Color) {
+	i.set(x, y, FloatModel.Convert(c).(Float).Y)
+}
+
+// load integrates a set of values, indexed as [y][x], passing each
+// through f first.
+func (i FloatImage) load(v [][]float64, f func(float64) float64) {
+	if len(v) != len(i) {
+		panic("integral: wrong number of rows to load")
+	}
+	for y, row := range v {
+		if len(row) != len(i[y]) {
+			panic("integral: wrong row width to load")
+		}
+		var rowsum float64
+		for x, c := range row {
+			rowsum += f(c)
+			i[y][x] = rowsum
+			if y > 0 {
+				i[y][x] += i[y-1][x]
+			}
+		}
+	}
+}
+
+// Load replaces the contents of the image with the integral of a
+// set of values, indexed as [y][x]. It panics if the values do not
+// have the same dimensions as the image.
+func (i FloatImage) Load(v [][]float64) {
+	i.load(v, func(c float64) float64 { return c })
+}
+
+// at returns the raw integral value at a point, or 0 if it is
+// above or to the left of the image.
+func (i FloatImage) at(x, y int) float64 {
+	return GenericImage[float64](i).at(x, y)
+}
+
+// Sum returns the sum of all pixels in a section of an image
+func (i FloatImage) Sum(r image.Rectangle) float64 {
+	return GenericImage[float64](i).Sum(r)
+}
+
+// Mean returns the average value of pixels in a section of an image
+func (i FloatImage) Mean(r image.Rectangle) float64 {
+	return GenericImage[float64](i).Mean(r)
+}
+
+func (i FloatSqImage) Bounds() image.Rectangle {
+	return FloatImage(i).Bounds()
+}
+
+// Load replaces the contents of the image with the integral of the
+// squares of a set of values, indexed as [y][x]. It panics if the
+// values do not have the same dimensions as the image.
+func (i FloatSqImage) Load(v [][]float64) {
+	FloatImage(i).load(v, func(c float64) float64 { return c * c })
+}
+
+// Sum returns the sum of all pixels in a section of an image
+func (i FloatSqImage) Sum(r image.Rectangle) float64 {
+	return FloatImage(i).Sum(r)
+}
+
+// Mean returns the average value of pixels in a section of an image
+func (i FloatSqImage) Mean(r image.Rectangle) float64 {
+	return FloatImage(i).Mean(r)
+}
+
+// floatDims returns the size of a float integral image as a point.
+// Unlike Bounds, this is safe to call on an empty image.
+func floatDims(i FloatImage) image.Point {
+	if len(i) == 0 {
+		return image.Point{}
+	}
+	return image.Pt(len(i[0]), len(i))
+}
+
+// FloatMeanStdDev calculates the mean and standard deviation of a
+// section of an image, using the corresponding regular and square
+// float integral images. It panics if i and sq have different bounds.
+func FloatMeanStdDev(i FloatImage, sq FloatSqImage, r image.Rectangle) (float64, float64) {
+	checkSizes("image and square image", floatDims(i), floatDims(FloatImage(sq)))
+	imean := i.Mean(r)
+	smean := sq.Mean(r)
+
+	variance := smean - (imean * imean)
+	if variance < 0 {
+		// guard against rounding errors for very uniform sections
+		variance = 0
+	}
+
+	return imean, math.Sqrt(variance)
+}
+
+// Scale returns a float integral image of the original image with
+// every pixel multiplied by factor, for example to weight a frame
+// before combining it with others. As integration is linear, this is
+// done by multiplying each prefix sum by factor. A float image is
+// returned so that fractional factors are not truncated.
+func (i Image) Scale(factor float64) FloatImage {
+	s := make(FloatImage, len(i))
+	for y, row := range i {
+		s[y] = make([]float64, len(row))
+		for x, v := range row {
+			s[y][x] = float64(v) * factor
+		}
+	}
+	return s
+}
+
+// set sets the value of the pixel at a point, assuming that the
+// pixels above and to the left of it have already been set.
+func (i FloatImage) set(x, y int, v float64) {
+	i[y][x] = v + i.at(x-1, y) + i.at(x, y-1) - i.at(x-1, y-1)
+}
+
+// orig returns the original value of the pixel at a point.
+func (i FloatImage) orig(x, y int) float64 {
+	if !(image.Point{x, y}.In(i.Bounds())) {
+		return 0
+	}
+	return i[y][x] - i.at(x-1, y) - i.at(x, y-1) + i.at(x-1, y-1)
+}
+
+// clampGray16 rounds a value to the nearest 16 bit grayscale value,
+// clamping it to the range 0-0xffff.
+func clampGray16(v float64) uint16 {
+	return uint16(math.Round(math.Max(0, math.Min(v, 0xffff))))
+}
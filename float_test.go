@@ -0,0 +1,172 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestFloat(t *testing.T) {
+	v := [][]float64{
+		{-1.5, 2.25, 100000, 0},
+		{3, -70000.5, 0.125, 8},
+		{250000, 4, 5, 6},
+	}
+	b := image.Rect(0, 0, 4, 3)
+	i := NewFloatImage(b)
+	sq := NewFloatSqImage(b)
+	i.Load(v)
+	sq.Load(v)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"single", image.Rect(1, 1, 2, 2)},
+		{"small", image.Rect(1, 0, 3, 2)},
+		{"toobig", image.Rect(2, 1, 2000, 2000)},
+		{"toosmall", image.Rect(-1, -1, 2, 2)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sum, sqsum float64
+			in := c.r.Intersect(b)
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					sum += v[y][x]
+					sqsum += v[y][x] * v[y][x]
+				}
+			}
+			n := float64(in.Dx() * in.Dy())
+			mean := sum / n
+			stddev := math.Sqrt(sqsum/n - mean*mean)
+
+			if s := i.Sum(c.r); math.Abs(s-sum) > 1e-6 {
+				t.Errorf("Sum wrong: expected %f, got %f\n", sum, s)
+			}
+			m, sd := FloatMeanStdDev(*i, *sq, c.r)
+			if math.Abs(m-mean) > 1e-6 {
+				t.Errorf("Mean wrong: expected %f, got %f\n", mean, m)
+			}
+			if math.Abs(sd-stddev) > 1e-3 {
+				t.Errorf("Standard deviation wrong: expected %f, got %f\n", stddev, sd)
+			}
+		})
+	}
+}
+
+func TestFloatMeanStdDevMismatched(t *testing.T) {
+	b := image.Rect(0, 0, 4, 3)
+	i := NewFloatImage(b)
+	sq := NewFloatSqImage(image.Rect(0, 0, 4, 2))
+	defer func() {
+		if recover() == nil {
+			t.Errorf("FloatMeanStdDev did not panic with mismatched images\n")
+		}
+	}()
+	FloatMeanStdDev(*i, *sq, b)
+}
+
+func TestScale(t *testing.T) {
+	i := newFromValues(20, 10, func(x, y int) uint64 {
+		return uint64(x*1000 + y*3 + 1)
+	})
+
+	cases := []struct {
+		name   string
+		factor float64
+		r      image.Rectangle
+	}{
+		{"half", 0.5, image.Rect(0, 0, 20, 10)},
+		{"halfSmall", 0.5, image.Rect(3, 2, 7, 9)},
+		{"third", 1.0 / 3, image.Rect(1, 1, 2, 2)},
+		{"double", 2, image.Rect(5, 0, 20, 4)},
+		{"zero", 0, image.Rect(0, 0, 20, 10)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := i.Scale(c.factor)
+			expected := i.Mean(c.r) * c.factor
+			if m := s.Mean(c.r); math.Abs(m-expected) > 1e-6 {
+				t.Errorf("Mean of scaled image wrong: expected %f, got %f\n", expected, m)
+			}
+		})
+	}
+}
+
+// hdrImage is an image of float values, standing in for a high
+// dynamic range source.
+type hdrImage [][]float64
+
+func (h hdrImage) ColorModel() color.Model { return FloatModel }
+
+func (h hdrImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, len(h[0]), len(h))
+}
+
+func (h hdrImage) At(x, y int) color.Color {
+	return Float{h[y][x]}
+}
+
+func TestFloatDraw(t *testing.T) {
+	src := hdrImage{
+		{70000, 1.5, 300000.25, 0},
+		{-2, 65535, 1e6, 12},
+		{100000, 4, 5, 6},
+	}
+	b := src.Bounds()
+	i := NewFloatImage(b)
+	draw.Draw(i, b, src, image.Point{}, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"single", image.Rect(2, 1, 3, 2)},
+		{"small", image.Rect(0, 0, 2, 2)},
+		{"toobig", image.Rect(1, 1, 2000, 2000)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sum float64
+			in := c.r.Intersect(b)
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					sum += src[y][x]
+				}
+			}
+			mean := sum / float64(in.Dx()*in.Dy())
+			if m := i.Mean(c.r); math.Abs(m-mean) > 1e-6 {
+				t.Errorf("Mean wrong: expected %f, got %f\n", mean, m)
+			}
+		})
+	}
+
+	for y, row := range src {
+		for x, v := range row {
+			if got := i.At(x, y).(Float).Y; math.Abs(got-v) > 1e-6 {
+				t.Errorf("At %d,%d wrong: expected %f, got %f\n", x, y, v, got)
+			}
+		}
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 2, 1))
+	gray.SetGray(0, 0, color.Gray{1})
+	gray.SetGray(1, 0, color.Gray{255})
+	g := NewFloatImage(gray.Bounds())
+	draw.Draw(g, gray.Bounds(), gray, image.Point{}, draw.Src)
+	if s := g.Sum(gray.Bounds()); s != 0x101+0xffff {
+		t.Errorf("Sum of drawn gray image wrong: expected %d, got %f\n", 0x101+0xffff, s)
+	}
+}
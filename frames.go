@@ -0,0 +1,85 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+)
+
+// FrameAccumulator keeps the running mean and variance of each pixel
+// over a sequence of frames of the same size, such as from a video,
+// using Welford's method so that the variance stays accurate over
+// many frames. The statistics can be taken as integral images, to
+// find the temporal mean and variance of sections of the frame.
+type FrameAccumulator struct {
+	n    int
+	mean [][]float64
+	m2   [][]float64 // sum of squared differences from the mean
+}
+
+// NewFrameAccumulator returns a new FrameAccumulator for frames with
+// the given bounds.
+func NewFrameAccumulator(r image.Rectangle) *FrameAccumulator {
+	a := FrameAccumulator{
+		mean: make([][]float64, r.Dy()),
+		m2:   make([][]float64, r.Dy()),
+	}
+	for y := range a.mean {
+		a.mean[y] = make([]float64, r.Dx())
+		a.m2[y] = make([]float64, r.Dx())
+	}
+	return &a
+}
+
+// Add adds the 16 bit grayscale values of a frame to the statistics.
+// It panics if the frame is not the same size as the accumulator.
+func (a *FrameAccumulator) Add(img image.Image) {
+	b := img.Bounds()
+	if b.Size() != a.Bounds().Size() {
+		panic("integral: frame has different bounds to accumulator")
+	}
+	a.n++
+	n := float64(a.n)
+	for y, row := range a.mean {
+		for x := range row {
+			v := float64(gray16(img.At(b.Min.X+x, b.Min.Y+y)))
+			d := v - row[x]
+			row[x] += d / n
+			a.m2[y][x] += d * (v - row[x])
+		}
+	}
+}
+
+// Bounds returns the bounds of the frames, anchored at (0,0).
+func (a FrameAccumulator) Bounds() image.Rectangle {
+	if len(a.mean) == 0 {
+		return image.Rectangle{}
+	}
+	return image.Rect(0, 0, len(a.mean[0]), len(a.mean))
+}
+
+// Frames returns the number of frames which have been added.
+func (a FrameAccumulator) Frames() int {
+	return a.n
+}
+
+// MeanImage returns an integral image of the mean of each pixel over
+// all of the frames added so far. If no frames have been added every
+// mean is 0.
+func (a FrameAccumulator) MeanImage() *FloatImage {
+	i := NewFloatImage(a.Bounds())
+	i.Load(a.mean)
+	return i
+}
+
+// VarianceImage returns an integral image of the population variance
+// of each pixel over all of the frames added so far. If no frames
+// have been added every variance is 0.
+func (a FrameAccumulator) VarianceImage() *FloatImage {
+	i := NewFloatImage(a.Bounds())
+	n := float64(highest(a.n, 1))
+	i.load(a.m2, func(c float64) float64 { return c / n })
+	return i
+}
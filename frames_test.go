@@ -0,0 +1,81 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestFrameAccumulator(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	a := NewFrameAccumulator(b)
+	for n := 0; n < 3; n++ {
+		a.Add(img)
+	}
+	if a.Frames() != 3 {
+		t.Errorf("Number of frames wrong: expected %d, got %d\n", 3, a.Frames())
+	}
+	mean := a.MeanImage()
+	variance := a.VarianceImage()
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 4, 5)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := integral.Mean(c.r)
+			if m := mean.Mean(c.r); math.Abs(m-expected) > 1e-6 {
+				t.Errorf("Mean wrong: expected %f, got %f\n", expected, m)
+			}
+			if v := variance.Mean(c.r); v != 0 {
+				t.Errorf("Variance of identical frames is not zero: %f\n", v)
+			}
+		})
+	}
+
+	// alternating black and white frames
+	r := image.Rect(0, 0, 8, 4)
+	black := image.NewGray16(r)
+	white := image.NewGray16(r)
+	draw.Draw(white, r, &image.Uniform{color.Gray16{0xffff}}, image.Point{}, draw.Src)
+	a = NewFrameAccumulator(r)
+	for n := 0; n < 4; n++ {
+		a.Add(black)
+		a.Add(white)
+	}
+	if m, expected := a.MeanImage().Mean(r), 0xffff/2.0; math.Abs(m-expected) > 1e-6 {
+		t.Errorf("Mean of alternating frames wrong: expected %f, got %f\n", expected, m)
+	}
+	expected := 0xffff / 2.0 * 0xffff / 2.0
+	if v := a.VarianceImage().Mean(image.Rect(2, 1, 5, 3)); math.Abs(v-expected) > 1e-3 {
+		t.Errorf("Variance of alternating frames wrong: expected %f, got %f\n", expected, v)
+	}
+}
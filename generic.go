@@ -0,0 +1,92 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+)
+
+// Numeric is the set of types which a GenericImage can hold.
+type Numeric interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// GenericImage is an integral image holding values of any numeric
+// type, for example int64 for signed data such as the difference
+// between two images, which would wrap around in an Image. An Image or
+// FloatImage can be converted to and from a GenericImage of uint64 or
+// float64 directly.
+type GenericImage[T Numeric] [][]T
+
+// NewGenericImage returns a new generic integral image with the given
+// bounds.
+func NewGenericImage[T Numeric](r image.Rectangle) *GenericImage[T] {
+	w, h := r.Dx(), r.Dy()
+	var rows GenericImage[T]
+	for i := 0; i < h; i++ {
+		col := make([]T, w)
+		rows = append(rows, col)
+	}
+	return &rows
+}
+
+func (i GenericImage[T]) Bounds() image.Rectangle {
+	if len(i) == 0 {
+		return image.Rectangle{}
+	}
+	return image.Rect(0, 0, len(i[0]), len(i))
+}
+
+// Load replaces the contents of the image with the integral of a
+// set of values, indexed as [y][x]. It panics if the values do not
+// have the same dimensions as the image.
+func (i GenericImage[T]) Load(v [][]T) {
+	if len(v) != len(i) {
+		panic("integral: wrong number of rows to load")
+	}
+	for y, row := range v {
+		if len(row) != len(i[y]) {
+			panic("integral: wrong row width to load")
+		}
+		var rowsum T
+		for x, c := range row {
+			rowsum += c
+			i[y][x] = rowsum
+			if y > 0 {
+				i[y][x] += i[y-1][x]
+			}
+		}
+	}
+}
+
+// at returns the raw integral value at a point, or 0 if it is
+// above or to the left of the image.
+func (i GenericImage[T]) at(x, y int) T {
+	if x < 0 || y < 0 {
+		return 0
+	}
+	return i[y][x]
+}
+
+// Sum returns the sum of all pixels in a section of an image
+func (i GenericImage[T]) Sum(r image.Rectangle) T {
+	r = r.Intersect(i.Bounds())
+	if r.Empty() {
+		return 0
+	}
+	x0, y0, x1, y1 := r.Min.X-1, r.Min.Y-1, r.Max.X-1, r.Max.Y-1
+	return (i.at(x1, y1) - i.at(x0, y1)) - (i.at(x1, y0) - i.at(x0, y0))
+}
+
+// Mean returns the average value of pixels in a section of an image.
+// Only the part of the section within the bounds of the image is
+// considered. If no pixels of the section are within the image the
+// mean is NaN.
+func (i GenericImage[T]) Mean(r image.Rectangle) float64 {
+	in := r.Intersect(i.Bounds())
+	return float64(i.Sum(in)) / float64(in.Dx()*in.Dy())
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestGenericInt64(t *testing.T) {
+	v := [][]int64{
+		{-5, 3, -2, 7},
+		{1, -9, 4, 0},
+		{-1, -1, -1, -1},
+	}
+	b := image.Rect(0, 0, 4, 3)
+	i := NewGenericImage[int64](b)
+	i.Load(v)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		sum  int64
+		mean float64
+	}{
+		{"fullimage", b, -5, -5 / 12.0},
+		{"negative", image.Rect(0, 0, 2, 2), -10, -2.5},
+		{"positive", image.Rect(2, 0, 4, 2), 9, 2.25},
+		{"toobig", image.Rect(1, 2, 2000, 2000), -3, -1},
+		{"toosmall", image.Rect(-1, -1, 1, 1), -5, -5},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s := i.Sum(c.r); s != c.sum {
+				t.Errorf("Sum wrong: expected %d, got %d\n", c.sum, s)
+			}
+			if m := i.Mean(c.r); m != c.mean {
+				t.Errorf("Mean wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+}
+
+func TestGenericFloat64(t *testing.T) {
+	v := [][]float64{
+		{0.5, -1.25, 70000},
+		{2, 0.125, -3},
+	}
+	b := image.Rect(0, 0, 3, 2)
+	i := NewGenericImage[float64](b)
+	i.Load(v)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		sum  float64
+	}{
+		{"fullimage", b, 69998.375},
+		{"column", image.Rect(1, 0, 2, 2), -1.125},
+		{"single", image.Rect(2, 0, 3, 1), 70000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s := i.Sum(c.r); math.Abs(s-c.sum) > 1e-9 {
+				t.Errorf("Sum wrong: expected %f, got %f\n", c.sum, s)
+			}
+		})
+	}
+}
+
+func TestGenericUint64(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	g := GenericImage[uint64](*integral)
+
+	for _, r := range []image.Rectangle{b, image.Rect(1, 1, 5, 5), image.Rect(-1, -1, 4, 5)} {
+		if g.Sum(r) != integral.Sum(r) {
+			t.Errorf("Sum of converted image differs for %v: original: %d, generic: %d\n", r, integral.Sum(r), g.Sum(r))
+		}
+	}
+}
@@ -1,3 +1,3 @@
 module rescribe.xyz/integral
 
-go 1.14
+go 1.18
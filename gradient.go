@@ -0,0 +1,99 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// absdiff returns the absolute difference between two values.
+func absdiff(a, b uint16) uint64 {
+	if a > b {
+		return uint64(a - b)
+	}
+	return uint64(b - a)
+}
+
+// EnergyMap returns a new integral image of the gradient magnitude of
+// img, for use as the energy function in seam carving. The Sum() of
+// any vertical or horizontal strip of the result is the total energy
+// of that strip.
+//
+// The gradient magnitude used is the sum of the absolute central
+// differences of the 16 bit grayscale values horizontally and
+// vertically, |I(x+1,y) - I(x-1,y)| + |I(x,y+1) - I(x,y-1)|, with
+// the edge pixels of the image repeated beyond its bounds.
+func EnergyMap(img image.Image) *Image {
+	g := grayValues(img)
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	return newFromValues(w, h, func(x, y int) uint64 {
+		l, r := highest(x-1, 0), lowest(x+1, w-1)
+		u, d := highest(y-1, 0), lowest(y+1, h-1)
+		return absdiff(g[y][r], g[y][l]) + absdiff(g[d][x], g[u][x])
+	})
+}
+
+// HorizontalBandContrast returns a map of the horizontal edges of
+// img, such as the tops and bottoms of lines of text. Each pixel is
+// the absolute difference between the mean of the band of bandHeight
+// rows just above it and the mean of the band of bandHeight rows
+// starting at it, so an edge between two rows lights up the lower of
+// them. The bands are also bandHeight pixels wide, making them square,
+// so that the contrast is measured over a local area rather than the
+// whole row; they are centred horizontally on the pixel, and clamped
+// to the bounds of the image. Pixels in the top row, which have no
+// band above them, are black. The band below a pixel includes its own
+// row, so pixels in the bottom row are still compared, against a band
+// of just that row.
+func HorizontalBandContrast(img image.Image, bandHeight int) *image.Gray16 {
+	b := img.Bounds()
+	i := fromImage(img)
+	out := image.NewGray16(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			x0 := x - bandHeight/2
+			above := image.Rect(x0, y-bandHeight, x0+bandHeight, y)
+			below := image.Rect(x0, y, x0+bandHeight, y+bandHeight)
+			a, aok := i.MeanOK(above)
+			c, cok := i.MeanOK(below)
+			if !aok || !cok {
+				continue
+			}
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{clampGray16(math.Abs(a - c))})
+		}
+	}
+	return out
+}
+
+// NewGradientMagImage returns a new integral image of the Sobel
+// gradient magnitude of img, so that the Mean() of a region of the
+// result is its edge density. The horizontal and vertical gradients
+// of the 16 bit grayscale values are found with the Sobel kernels
+//
+//	-1 0 1      -1 -2 -1
+//	-2 0 2       0  0  0
+//	-1 0 1       1  2  1
+//
+// and the magnitude of each pixel is √(gx² + gy²), rounded to the
+// nearest whole number. This is not normalised, so a sharp edge from
+// black to white has a magnitude of 4 * 0xffff. The edge pixels of the
+// image are repeated beyond its bounds, so a uniform border does not
+// create edges.
+func NewGradientMagImage(img image.Image) *Image {
+	g := grayValues(img)
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	return newFromValues(w, h, func(x, y int) uint64 {
+		l, r := highest(x-1, 0), lowest(x+1, w-1)
+		u, d := highest(y-1, 0), lowest(y+1, h-1)
+		p := func(x, y int) float64 { return float64(g[y][x]) }
+		gx := p(r, u) + 2*p(r, y) + p(r, d) - p(l, u) - 2*p(l, y) - p(l, d)
+		gy := p(l, d) + 2*p(x, d) + p(r, d) - p(l, u) - 2*p(x, u) - p(r, u)
+		return uint64(math.Round(math.Hypot(gx, gy)))
+	})
+}
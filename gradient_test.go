@@ -0,0 +1,132 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEnergyMap(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 10, 6))
+	for y := 0; y < 6; y++ {
+		for x := 5; x < 10; x++ {
+			img.SetGray16(x, y, color.Gray16{0xffff})
+		}
+	}
+	e := EnergyMap(img)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		sum  uint64
+	}{
+		{"leftflat", image.Rect(0, 0, 3, 6), 0},
+		{"rightflat", image.Rect(7, 0, 10, 6), 0},
+		{"edgeleft", image.Rect(4, 0, 5, 6), 6 * 0xffff},
+		{"edgeright", image.Rect(5, 0, 6, 6), 6 * 0xffff},
+		{"horizontalstrip", image.Rect(0, 2, 10, 3), 2 * 0xffff},
+		{"fullimage", e.Bounds(), 12 * 0xffff},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sum := e.Sum(c.r)
+			if sum != c.sum {
+				t.Errorf("Energy sum wrong: expected %d, got %d\n", c.sum, sum)
+			}
+		})
+	}
+}
+
+func TestHorizontalBandContrast(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 20, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 20; x++ {
+			v := uint16(0xffff)
+			if y >= 10 && y < 20 {
+				v = 0
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+	edges := HorizontalBandContrast(img, 4)
+
+	cases := []struct {
+		name     string
+		x, y     int
+		expected uint16
+	}{
+		{"top", 10, 0, 0},
+		{"flat", 10, 5, 0},
+		{"edge", 10, 10, 0xffff},
+		{"nearEdge", 10, 9, 0xffff * 3 / 4},
+		{"secondEdge", 10, 20, 0xffff},
+		{"edgeAtSide", 0, 20, 0xffff},
+		{"middleOfStripe", 10, 15, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := edges.Gray16At(c.x, c.y).Y; v != c.expected {
+				t.Errorf("Band contrast wrong: expected %d, got %d\n", c.expected, v)
+			}
+		})
+	}
+
+	for y := 1; y < 30; y++ {
+		v := edges.Gray16At(10, y).Y
+		if y != 10 && y != 20 && v == 0xffff {
+			t.Errorf("Unexpected peak at row %d\n", y)
+		}
+	}
+
+	// the bottom row is compared against a band of just itself
+	for x := 0; x < 20; x++ {
+		img.SetGray16(x, 29, color.Gray16{0})
+	}
+	if v := HorizontalBandContrast(img, 4).Gray16At(10, 29).Y; v != 0xffff {
+		t.Errorf("Band contrast of bottom row wrong: expected %d, got %d\n", 0xffff, v)
+	}
+}
+
+func TestGradientMagImage(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 10; x < 20; x++ {
+			img.SetGray16(x, y, color.Gray16{0xffff})
+		}
+	}
+	mag := NewGradientMagImage(img)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		mean float64
+	}{
+		{"edge", image.Rect(9, 0, 11, 10), 4 * 0xffff},
+		{"aroundEdge", image.Rect(7, 0, 13, 10), 4 * 0xffff / 3.0},
+		{"black", image.Rect(0, 0, 8, 10), 0},
+		{"white", image.Rect(12, 0, 20, 10), 0},
+		{"fullimage", image.Rect(0, 0, 20, 10), 4 * 0xffff / 10.0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if m := mag.Mean(c.r); math.Abs(m-c.mean) > 1e-6 {
+				t.Errorf("Edge density wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+
+	diagonal := image.NewGray16(image.Rect(0, 0, 3, 3))
+	diagonal.SetGray16(2, 0, color.Gray16{1000})
+	// gx = 1000 and gy = -1000 at the centre
+	if v := NewGradientMagImage(diagonal).Sum(image.Rect(1, 1, 2, 2)); v != uint64(math.Round(1000*math.Sqrt2)) {
+		t.Errorf("Diagonal magnitude wrong: expected %d, got %d\n", uint64(math.Round(1000*math.Sqrt2)), v)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+)
+
+// TwoRectFeature returns the value of a two-rectangle Haar-like
+// feature, as used in Viola-Jones cascades: the sum of the white
+// section minus the sum of the black section. The result is signed,
+// so it is negative when the black section is brighter.
+func (i Image) TwoRectFeature(white, black image.Rectangle) int64 {
+	return int64(i.Sum(white)) - int64(i.Sum(black))
+}
+
+// ThreeRectFeature returns the value of a three-rectangle Haar-like
+// feature: the sum of the two outer white sections minus the sum of
+// the central black section. The sections are not weighted, so for a
+// balanced feature the black section should be as large as both
+// white sections together.
+func (i Image) ThreeRectFeature(white1, black, white2 image.Rectangle) int64 {
+	return int64(i.Sum(white1)) + int64(i.Sum(white2)) - int64(i.Sum(black))
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestHaarFeatures(t *testing.T) {
+	// Columns of 1, 2, 3, 4 from left to right, over 2 rows
+	img := image.NewGray16(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			img.SetGray16(x, y, color.Gray16{uint16(x + 1)})
+		}
+	}
+	b := img.Bounds()
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	col := func(x int) image.Rectangle {
+		return image.Rect(x, 0, x+1, 2)
+	}
+
+	twocases := []struct {
+		name         string
+		white, black image.Rectangle
+		want         int64
+	}{
+		{"whitebrighter", col(3), col(0), 8 - 2},
+		{"blackbrighter", col(0), col(3), 2 - 8},
+		{"halves", image.Rect(0, 0, 2, 2), image.Rect(2, 0, 4, 2), 6 - 14},
+		{"equal", col(1), col(1), 0},
+	}
+
+	for _, c := range twocases {
+		t.Run(c.name, func(t *testing.T) {
+			got := integral.TwoRectFeature(c.white, c.black)
+			if got != c.want {
+				t.Errorf("Two rectangle feature wrong: expected %d, got %d\n", c.want, got)
+			}
+		})
+	}
+
+	threecases := []struct {
+		name                  string
+		white1, black, white2 image.Rectangle
+		want                  int64
+	}{
+		{"centre", col(0), image.Rect(1, 0, 3, 2), col(3), 2 + 8 - 10},
+		{"darkcentre", col(2), col(0), col(3), 6 + 8 - 2},
+		{"brightcentre", col(0), col(3), col(1), 2 + 4 - 8},
+	}
+
+	for _, c := range threecases {
+		t.Run(c.name, func(t *testing.T) {
+			got := integral.ThreeRectFeature(c.white1, c.black, c.white2)
+			if got != c.want {
+				t.Errorf("Three rectangle feature wrong: expected %d, got %d\n", c.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// IntegralHistogram is a set of integral images, one for each bin of
+// a histogram of pixel values, each counting the pixels whose value
+// falls into that bin. This allows the histogram of any section of
+// an image to be found in constant time for each bin, which makes
+// calculating statistics like the median of a sliding window fast.
+//
+// Note that an IntegralHistogram takes as much memory as an integral
+// image for each bin, so the number of bins should be kept low for
+// large images.
+type IntegralHistogram struct {
+	bins []Image
+}
+
+// NewIntegralHistogram returns a new IntegralHistogram for img, with
+// the 16 bit grayscale range split into the given number of equally
+// sized bins. The number of bins is clamped to between 1 and 65536.
+func NewIntegralHistogram(img image.Image, bins int) *IntegralHistogram {
+	bins = highest(lowest(bins, 0x10000), 1)
+	g := grayValues(img)
+	b := img.Bounds()
+
+	var h IntegralHistogram
+	h.bins = make([]Image, bins)
+	for n := range h.bins {
+		h.bins[n] = *newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+			if h.bin(g[y][x]) == n {
+				return 1
+			}
+			return 0
+		})
+	}
+	return &h
+}
+
+// Bins returns the number of bins in the histogram.
+func (h IntegralHistogram) Bins() int {
+	return len(h.bins)
+}
+
+// bin returns the bin that a value falls into.
+func (h IntegralHistogram) bin(v uint16) int {
+	return int(uint64(v) * uint64(len(h.bins)) / 0x10000)
+}
+
+// BinRange returns the lowest and highest values which fall into a
+// bin.
+func (h IntegralHistogram) BinRange(bin int) (uint16, uint16) {
+	n := uint64(len(h.bins))
+	lo := (uint64(bin)*0x10000 + n - 1) / n
+	hi := (uint64(bin+1)*0x10000+n-1)/n - 1
+	return uint16(lo), uint16(hi)
+}
+
+// RegionHistogram returns the number of pixels in a section of the
+// image which fall into each bin. The section is clamped to the
+// bounds of the image.
+func (h IntegralHistogram) RegionHistogram(r image.Rectangle) []uint64 {
+	return h.regionHistogram(r, make([]uint64, len(h.bins)))
+}
+
+// regionHistogram is like RegionHistogram, but stores the counts in
+// out, which must have an element for each bin.
+func (h IntegralHistogram) regionHistogram(r image.Rectangle, out []uint64) []uint64 {
+	for n, i := range h.bins {
+		out[n] = i.Sum(r)
+	}
+	return out
+}
+
+// Percentile returns the value below which the given percentage of
+// the pixels in a section of the image fall, so for example a p of
+// 50 gives the median. p is clamped to between 0 and 100. As values
+// are only known to the precision of a bin, the value returned is the
+// middle of the bin containing the percentile. The section is clamped to the bounds of the image; if
+// it contains no pixels, 0 is returned.
+func (h IntegralHistogram) Percentile(r image.Rectangle, p float64) uint16 {
+	if len(h.bins) == 0 {
+		return 0
+	}
+	r = r.Intersect(h.bins[0].Bounds())
+	total := r.Dx() * r.Dy()
+	if total == 0 {
+		return 0
+	}
+
+	p = math.Max(0, math.Min(p, 100))
+	rank := uint64(math.Ceil(p / 100 * float64(total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var count uint64
+	bin := len(h.bins) - 1
+	for n, c := range h.RegionHistogram(r) {
+		count += c
+		if count >= rank {
+			bin = n
+			break
+		}
+	}
+
+	lo, hi := h.BinRange(bin)
+	return lo + (hi-lo)/2
+}
+
+// EntropyImage returns a map of the local entropy of img, where each
+// pixel is the Shannon entropy of the histogram of the window of
+// windowSize by windowSize pixels around it, with values split into
+// the given number of bins. Windows are clamped to the bounds of the
+// image. Busy areas like halftones have a high entropy, while flat
+// areas like solid text or background have an entropy near zero.
+//
+// Entropy is scaled to fill the 16 bit grayscale range, so that the
+// highest possible entropy, log2(bins), is white.
+func EntropyImage(img image.Image, windowSize, bins int) *image.Gray16 {
+	b := img.Bounds()
+	h := NewIntegralHistogram(img, bins)
+	maxEntropy := math.Log2(float64(h.Bins()))
+
+	counts := make([]uint64, h.Bins())
+	out := image.NewGray16(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r := centredWindow(x, y, windowSize).Intersect(h.bins[0].Bounds())
+			total := float64(r.Dx() * r.Dy())
+			var e float64
+			for _, n := range h.regionHistogram(r, counts) {
+				if n == 0 {
+					continue
+				}
+				p := float64(n) / total
+				e -= p * math.Log2(p)
+			}
+			var v uint16
+			if maxEntropy > 0 {
+				v = uint16(math.Round(math.Min(e/maxEntropy, 1) * 0xffff))
+			}
+			out.SetGray16(b.Min.X+x, b.Min.Y+y, color.Gray16{v})
+		}
+	}
+	return out
+}
+
+// histogram returns the number of pixels of img with each 16 bit
+// grayscale value.
+func histogram(img image.Image) []uint64 {
+	hist := make([]uint64, 0x10000)
+	for _, row := range grayValues(img) {
+		for _, v := range row {
+			hist[v]++
+		}
+	}
+	return hist
+}
+
+// Otsu finds a global threshold for img using Otsu's method, which
+// chooses the threshold that maximises the variance between the
+// pixels at or below it and those above it. It returns the threshold
+// and a binarized copy of img, in which pixels above the threshold
+// are white and the rest black.
+func Otsu(img image.Image) (threshold uint16, binarized *image.Gray) {
+	hist := histogram(img)
+	var total, sum float64
+	for v, n := range hist {
+		total += float64(n)
+		sum += float64(v) * float64(n)
+	}
+
+	var w0, sum0, best float64
+	for t, n := range hist {
+		w0 += float64(n)
+		sum0 += float64(t) * float64(n)
+		w1 := total - w0
+		if w0 == 0 || w1 == 0 {
+			continue
+		}
+		d := sum0/w0 - (sum-sum0)/w1
+		between := w0 * w1 * d * d
+		if between > best {
+			best = between
+			threshold = uint16(t)
+		}
+	}
+
+	binarized = binarize(img, func(x, y int, v uint16) bool {
+		return v > threshold
+	})
+	return threshold, binarized
+}
+
+// PercentileThreshold finds the value below which the given percentage
+// of the pixels of img fall, so for example a percentile of 20 gives
+// a threshold which marks the darkest 20% of the image as ink. It
+// returns the threshold and a binarized copy of img, in which pixels
+// above the threshold are white and the rest black. percentile is
+// clamped to between 0 and 100. A percentile of 0 gives the lowest
+// value in the image, below which no pixels fall, and marks no pixels
+// as ink; one of 100 gives the highest, and marks every pixel as ink.
+func PercentileThreshold(img image.Image, percentile float64) (uint16, *image.Gray) {
+	hist := histogram(img)
+	b := img.Bounds()
+	total := b.Dx() * b.Dy()
+
+	var threshold uint16
+	percentile = math.Max(0, math.Min(percentile, 100))
+	rank := uint64(math.Ceil(percentile / 100 * float64(total)))
+	var count uint64
+	for v, n := range hist {
+		count += n
+		threshold = uint16(v)
+		if count >= rank && count > 0 {
+			break
+		}
+	}
+
+	return threshold, binarize(img, func(x, y int, v uint16) bool {
+		return rank == 0 || v > threshold
+	})
+}
@@ -0,0 +1,250 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"math"
+	"os"
+	"sort"
+	"testing"
+)
+
+func TestRegionHistogram(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	g := grayValues(img)
+	h := NewIntegralHistogram(img, 16)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", img.Bounds()},
+		{"small", image.Rect(10, 20, 40, 35)},
+		{"single", image.Rect(50, 50, 51, 51)},
+		{"toobig", image.Rect(60, 80, 200, 200)},
+		{"outside", image.Rect(200, 200, 300, 300)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := make([]uint64, 16)
+			in := c.r.Intersect(img.Bounds())
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					expected[g[y][x]/0x1000]++
+				}
+			}
+			got := h.RegionHistogram(c.r)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("RegionHistogram wrong: expected %v, got %v\n", expected, got)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			v := uint16(20000)
+			if x >= 5 {
+				v = uint16(x * 1000)
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+
+	cases := []struct {
+		name string
+		bins int
+		r    image.Rectangle
+		p    float64
+		want uint16
+	}{
+		{"uniform", 4096, image.Rect(0, 0, 5, 10), 50, 20000},
+		{"uniformfewbins", 256, image.Rect(0, 0, 5, 10), 50, 20000},
+		{"uniformlow", 256, image.Rect(1, 2, 4, 9), 0, 20000},
+		{"uniformhigh", 256, image.Rect(1, 2, 4, 9), 100, 20000},
+		{"ramp", 4096, image.Rect(5, 0, 10, 10), 50, 7000},
+		{"rampmax", 4096, image.Rect(5, 0, 10, 10), 100, 9000},
+		{"rampmin", 4096, image.Rect(5, 0, 10, 10), 0, 5000},
+		{"rampnegative", 4096, image.Rect(5, 0, 10, 10), -10, 5000},
+		{"rampover", 4096, image.Rect(5, 0, 10, 10), 150, 9000},
+		{"mixed", 4096, image.Rect(0, 0, 10, 10), 75, 20000},
+		{"empty", 16, image.Rect(20, 20, 30, 30), 50, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := NewIntegralHistogram(img, c.bins)
+			got := h.Percentile(c.r, c.p)
+			tolerance := 0x10000 / c.bins
+			diff := int(got) - int(c.want)
+			if diff < -tolerance || diff > tolerance {
+				t.Errorf("Percentile wrong: expected %d, got %d\n", c.want, got)
+			}
+		})
+	}
+}
+
+func TestOtsu(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			v := uint16(50000 + x*10)
+			if y < 3 {
+				v = uint16(10000 + x*10)
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+
+	threshold, bin := Otsu(img)
+	if threshold < 10090 || threshold >= 50000 {
+		t.Errorf("Threshold %d does not separate the two classes\n", threshold)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			want := uint8(255)
+			if y < 3 {
+				want = 0
+			}
+			if v := bin.GrayAt(x, y).Y; v != want {
+				t.Fatalf("Binarized pixel at %d,%d wrong: expected %d, got %d\n", x, y, want, v)
+			}
+		}
+	}
+
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	png, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	threshold, _ = Otsu(png)
+	if threshold != 32639 {
+		t.Errorf("Threshold of test image changed: expected %d, got %d\n", 32639, threshold)
+	}
+}
+
+func TestPercentileThreshold(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	var values []int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			values = append(values, int(gray16(img.At(x, y))))
+		}
+	}
+	sort.Ints(values)
+
+	for _, p := range []float64{5, 20, 50, 90} {
+		t.Run(fmt.Sprintf("%.0f", p), func(t *testing.T) {
+			threshold, bin := PercentileThreshold(img, p)
+			expected := values[int(math.Ceil(p/100*float64(len(values))))-1]
+			if int(threshold) != expected {
+				t.Errorf("Threshold wrong: expected %d, got %d\n", expected, threshold)
+			}
+			var black int
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if bin.GrayAt(x, y).Y == 0 {
+						black++
+					}
+				}
+			}
+			if float64(black) < p/100*float64(len(values)) {
+				t.Errorf("Too few pixels below threshold: %d of %d\n", black, len(values))
+			}
+		})
+	}
+
+	limits := []struct {
+		name      string
+		p         float64
+		threshold int
+		black     int
+	}{
+		{"zero", 0, values[0], 0},
+		{"negative", -10, values[0], 0},
+		{"hundred", 100, values[len(values)-1], len(values)},
+		{"over", 150, values[len(values)-1], len(values)},
+	}
+
+	for _, c := range limits {
+		t.Run(c.name, func(t *testing.T) {
+			threshold, bin := PercentileThreshold(img, c.p)
+			if int(threshold) != c.threshold {
+				t.Errorf("Threshold wrong: expected %d, got %d\n", c.threshold, threshold)
+			}
+			if n := countBlack(bin); n != c.black {
+				t.Errorf("Number of black pixels wrong: expected %d, got %d\n", c.black, n)
+			}
+		})
+	}
+}
+
+func TestEntropyImage(t *testing.T) {
+	// left half is flat, right half cycles through one value from
+	// each of 4 bins
+	img := image.NewGray16(image.Rect(0, 0, 20, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			v := uint16(0x8000)
+			if x >= 10 {
+				v = uint16((x+2*y)%4) * 0x4000
+			}
+			img.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+	e := EntropyImage(img, 4, 4)
+
+	cases := []struct {
+		name     string
+		x, y     int
+		expected uint16
+	}{
+		{"flat", 4, 5, 0},
+		{"flatCorner", 0, 0, 0},
+		{"busy", 15, 5, 0xffff},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := e.Gray16At(c.x, c.y).Y
+			if got != c.expected {
+				t.Errorf("Entropy wrong: expected %v, got %v\n", c.expected, got)
+			}
+		})
+	}
+
+	if got := EntropyImage(img, 4, 1).Gray16At(15, 5).Y; got != 0 {
+		t.Errorf("Entropy with a single bin wrong: expected 0, got %v\n", got)
+	}
+}
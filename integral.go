@@ -16,16 +16,28 @@
 // Another common requirement is standard deviation over an area
 // of an image. This can be calculated by creating an integral
 // image and squared integral image (SqImage) for a base image, and
-// passing them to the MeanStdDev() function provided.
+// passing them to the MeanStdDev() function provided, or more
+// simply by creating a StatImage, which holds both.
 package integral
 
 import (
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"math"
+	"math/bits"
+	"runtime"
+	"sync"
 )
 
-// Image is an integral image
+// Image is an integral image, indexed as [y][x].
+//
+// Every row must be the same width, as the width of the image is taken
+// from the first row, and no other rows are checked when accessing
+// them, for speed. An Image with rows of different widths, for example
+// after slicing some of them by hand, can give wrong results or panic.
+// Validate can be used to check an Image which may be malformed.
 type Image [][]uint64
 
 // SqImage is a Square integral image.
@@ -40,6 +52,15 @@ func (i Image) Bounds() image.Rectangle {
 	return image.Rect(0, 0, len(i[0]), len(i))
 }
 
+// Dims returns the width and height of the image. Unlike Bounds, this
+// is safe to call on an empty image, returning 0, 0.
+func (i Image) Dims() (w, h int) {
+	if len(i) == 0 {
+		return 0, 0
+	}
+	return len(i[0]), len(i)
+}
+
 // at64 is used to return the raw uint64 for a given pixel. Accessing
 // this separately to a (potentially lossy) conversion to a Gray16 is
 // necessary for SqImage to function accurately.
@@ -84,9 +105,42 @@ func (i Image) set64(x, y int, c uint64) {
 	i[y][x] = final
 }
 
+// Set sets the pixel at a point. The integral values are derived from
+// those above and to the left, so this is only correct when pixels
+// are set in order, from top to bottom and left to right, and each
+// only once, as happens when drawing a whole image onto a new
+// integral image with draw.Draw and draw.Src. Setting a pixel does not
+// update the values below and to the right of it, so drawing over
+// part of an image which has already been drawn, as draw.Over does,
+// leaves the image inconsistent. Use DrawSrc for these cases.
+//
+// Drawing only part of an image, into a section r of a new integral
+// image, gives correct sums for sections which do not extend below or
+// to the right of r, as everything above and to the left of r is
+// still zero; but the values below and to the right of r are left at
+// zero rather than including the drawn pixels. DrawSrc keeps those
+// correct too.
 func (i Image) Set(x, y int, c color.Color) {
-	gray := color.Gray16Model.Convert(c).(color.Gray16).Y
-	i.set64(x, y, uint64(gray))
+	i.set64(x, y, uint64(gray16(c)))
+}
+
+// SetGray16 sets the pixel at a point to a 16 bit grayscale value,
+// avoiding any colour conversion. The same ordering requirements as
+// for Set apply.
+func (i Image) SetGray16(x, y int, v uint16) {
+	i.set64(x, y, uint64(v))
+}
+
+// gray16 returns the 16 bit grayscale value of a colour. Grayscale
+// colours are handled directly, skipping the general conversion.
+func gray16(c color.Color) uint16 {
+	switch g := c.(type) {
+	case color.Gray16:
+		return g.Y
+	case color.Gray:
+		return uint16(g.Y) * 0x101
+	}
+	return color.Gray16Model.Convert(c).(color.Gray16).Y
 }
 
 // NewImage returns a new integral image with the given bounds.
@@ -100,12 +154,52 @@ func NewImage(r image.Rectangle) *Image {
 	return &rows
 }
 
+// Reset resizes the image to the given bounds and sets every value to
+// zero, so that it can be reused for a new image. The existing rows
+// are reused where they are large enough, so resetting to the same or
+// smaller bounds does not allocate.
+func (i *Image) Reset(r image.Rectangle) {
+	w, h := r.Dx(), r.Dy()
+	rows := (*i)[:cap(*i)]
+	if len(rows) < h {
+		rows = append(rows, make(Image, h-len(rows))...)
+	}
+	rows = rows[:h]
+	for y := range rows {
+		if cap(rows[y]) < w {
+			rows[y] = make([]uint64, w)
+			continue
+		}
+		rows[y] = rows[y][:w]
+		for x := range rows[y] {
+			rows[y][x] = 0
+		}
+	}
+	*i = rows
+}
+
+// Zero sets every value of the image to zero, keeping its bounds and
+// storage, so that a new image of the same size can be drawn into it.
+func (i Image) Zero() {
+	for y := range i {
+		for x := range i[y] {
+			i[y][x] = 0
+		}
+	}
+}
+
 func (i SqImage) ColorModel() color.Model { return Image(i).ColorModel() }
 
 func (i SqImage) Bounds() image.Rectangle {
 	return Image(i).Bounds()
 }
 
+// At returns the colour of the original pixel at a point. As the
+// square of a 16 bit value does not fit into a Gray16, this is the
+// square root of the stored value, rounded down, rather than the
+// stored value itself. At is therefore only intended for display and
+// for compatibility with the image.Image interface; the exact sums
+// of squares should be taken from SumSquares.
 func (i SqImage) At(x, y int) color.Color {
 	c := Image(i).at64(x, y)
 	rt := math.Sqrt(float64(c))
@@ -113,7 +207,7 @@ func (i SqImage) At(x, y int) color.Color {
 }
 
 func (i SqImage) Set(x, y int, c color.Color) {
-	gray := uint64(color.Gray16Model.Convert(c).(color.Gray16).Y)
+	gray := uint64(gray16(c))
 	Image(i).set64(x, y, gray*gray)
 }
 
@@ -138,59 +232,178 @@ func highest(a, b int) int {
 	return b
 }
 
-func (i Image) topLeft(r image.Rectangle) uint64 {
-	b := i.Bounds()
-	x := r.Min.X - 1
-	y := r.Min.Y - 1
-	x = lowest(x, b.Max.X-1)
-	y = lowest(y, b.Max.Y-1)
-	if x < 0 || y < 0 {
+// Sum returns the sum of all pixels in a section of an image. Only
+// the part of the section within the bounds of the image is
+// considered, so a section entirely outside of it, or an inverted
+// one, has a sum of 0.
+func (i Image) Sum(r image.Rectangle) uint64 {
+	return i.SumXY(r.Min.X, r.Min.Y, r.Max.X, r.Max.Y)
+}
+
+// SumXY returns the sum of all pixels in a section of an image, as
+// with Sum, with the section given as the coordinates of its top left
+// and bottom right corners rather than an image.Rectangle, which is
+// convenient where the coordinates are already held separately. Sum
+// is implemented with it, so the two perform the same.
+func (i Image) SumXY(minX, minY, maxX, maxY int) uint64 {
+	minX, minY = highest(minX, 0), highest(minY, 0)
+	maxX, maxY = lowest(maxX, len(i[0])), lowest(maxY, len(i))
+	if minX >= maxX || minY >= maxY {
 		return 0
 	}
-	return i[y][x]
+	sum := i[maxY-1][maxX-1]
+	if minX > 0 {
+		sum -= i[maxY-1][minX-1]
+	}
+	if minY > 0 {
+		sum -= i[minY-1][maxX-1]
+	}
+	if minX > 0 && minY > 0 {
+		sum += i[minY-1][minX-1]
+	}
+	return sum
 }
 
-func (i Image) topRight(r image.Rectangle) uint64 {
-	b := i.Bounds()
-	x := lowest(r.Max.X-1, b.Max.X-1)
-	y := r.Min.Y - 1
-	y = lowest(y, b.Max.Y-1)
-	if x < 0 || y < 0 {
+// SumArea returns the sum of all pixels in a section of an image, as
+// with Sum, along with the number of pixels summed, which is the area
+// of the part of the section within the bounds of the image.
+func (i Image) SumArea(r image.Rectangle) (sum uint64, area int) {
+	in := r.Intersect(i.Bounds())
+	return i.sumIn(in), in.Dx() * in.Dy()
+}
+
+// sumIn returns the sum of all pixels in a section of an image which
+// is already known to be within its bounds, avoiding the intersection
+// with the bounds which Sum does.
+func (i Image) sumIn(r image.Rectangle) uint64 {
+	if r.Empty() {
 		return 0
 	}
-	return i[y][x]
+	x0, y0, x1, y1 := r.Min.X-1, r.Min.Y-1, r.Max.X-1, r.Max.Y-1
+	sum := i[y1][x1]
+	if x0 >= 0 {
+		sum -= i[y1][x0]
+	}
+	if y0 >= 0 {
+		sum -= i[y0][x1]
+	}
+	if x0 >= 0 && y0 >= 0 {
+		sum += i[y0][x0]
+	}
+	return sum
 }
 
-func (i Image) bottomLeft(r image.Rectangle) uint64 {
-	b := i.Bounds()
-	x := r.Min.X - 1
-	x = lowest(x, b.Max.X-1)
-	y := lowest(r.Max.Y-1, b.Max.Y-1)
-	if x < 0 || y < 0 {
+// Total returns the sum of all pixels in the image. This is simply
+// the bottom right value of the integral image, so is cheaper than
+// calling Sum with the bounds of the image.
+func (i Image) Total() uint64 {
+	if len(i) == 0 || len(i[len(i)-1]) == 0 {
 		return 0
 	}
-	return i[y][x]
+	last := i[len(i)-1]
+	return last[len(last)-1]
 }
 
-func (i Image) bottomRight(r image.Rectangle) uint64 {
+// PrefixSumAt returns the raw value of the integral image at a point,
+// which is the sum of all pixels above and to the left of it,
+// inclusive. Points beyond the right or bottom of the image are
+// clamped to its edge, and 0 is returned for any point to the left of
+// or above the image, so that custom region arithmetic can be done
+// without special cases at the edges.
+func (i Image) PrefixSumAt(x, y int) uint64 {
 	b := i.Bounds()
-	x := lowest(r.Max.X-1, b.Max.X-1)
-	y := lowest(r.Max.Y-1, b.Max.Y-1)
+	x = lowest(x, b.Max.X-1)
+	y = lowest(y, b.Max.Y-1)
 	if x < 0 || y < 0 {
 		return 0
 	}
 	return i[y][x]
 }
 
-// Sum returns the sum of all pixels in a section of an image
-func (i Image) Sum(r image.Rectangle) uint64 {
-	return i.bottomRight(r) + i.topLeft(r) - i.topRight(r) - i.bottomLeft(r)
+// ErrOutOfBounds is returned when a section does not overlap an
+// image at all.
+var ErrOutOfBounds = errors.New("integral: section is outside of image")
+
+// ErrBoundsMismatch is returned when images which should correspond
+// to each other have different bounds.
+var ErrBoundsMismatch = errors.New("integral: images have different bounds")
+
+// ErrInvalid is returned when an integral image is not internally
+// consistent, for example because it has been corrupted.
+var ErrInvalid = errors.New("integral: invalid integral image")
+
+// SumStrict returns the sum of all pixels in a section of an image,
+// like Sum, but returns an error wrapping ErrOutOfBounds if no part
+// of the section is within the image, rather than silently returning
+// 0. Sections which are partly outside of the image are clamped to
+// its bounds.
+func (i Image) SumStrict(r image.Rectangle) (uint64, error) {
+	in := r.Intersect(i.Bounds())
+	if in.Empty() {
+		return 0, fmt.Errorf("%w: %v is not within %v", ErrOutOfBounds, r, i.Bounds())
+	}
+	return i.Sum(in), nil
+}
+
+// Validate checks that the image is a plausible integral image, such
+// as after loading it from elsewhere. As pixels cannot be negative,
+// each prefix sum must be at least as large as those to its left and
+// above it, and every row must be the same width. An error wrapping
+// ErrInvalid is returned describing the first point that is not.
+//
+// Note that this cannot catch every kind of corruption, only that
+// which makes the image impossible.
+func (i Image) Validate() error {
+	for y, row := range i {
+		if len(row) != len(i[0]) {
+			return fmt.Errorf("%w: row %d is %d wide rather than %d", ErrInvalid, y, len(row), len(i[0]))
+		}
+		for x, v := range row {
+			if x > 0 && v < row[x-1] {
+				return fmt.Errorf("%w: %d at %d,%d is less than %d to its left", ErrInvalid, v, x, y, row[x-1])
+			}
+			if y > 0 && v < i[y-1][x] {
+				return fmt.Errorf("%w: %d at %d,%d is less than %d above it", ErrInvalid, v, x, y, i[y-1][x])
+			}
+		}
+	}
+	return nil
 }
 
-// Mean returns the average value of pixels in a section of an image
+// Mean returns the average value of pixels in a section of an image.
+// Only the part of the section within the bounds of the image is
+// considered, for both the sum and the number of pixels it is
+// divided by. If no pixels of the section are within the image the
+// mean is NaN; MeanOK can be used to detect that case instead.
 func (i Image) Mean(r image.Rectangle) float64 {
+	sum, area := i.SumArea(r)
+	return float64(sum) / float64(area)
+}
+
+// MeanGray8 returns the average value of pixels in a section of an
+// image, scaled to the 0-255 range of 8 bit grayscale. Pixels are
+// stored with 16 bit precision, with 8 bit sources promoted by
+// multiplying by 257 (0x101), so that 0xff becomes 0xffff; the mean
+// is scaled back by dividing by 257 and rounding to the nearest
+// integer. If no pixels of the section are within the image, 0 is
+// returned.
+func (i Image) MeanGray8(r image.Rectangle) uint8 {
+	mean, ok := i.MeanOK(r)
+	if !ok {
+		return 0
+	}
+	return uint8(math.Round(mean / 257))
+}
+
+// MeanOK returns the average value of pixels in a section of an
+// image, as with Mean, and whether the section contains any pixels
+// within the image. If it does not, the mean returned is 0.
+func (i Image) MeanOK(r image.Rectangle) (float64, bool) {
 	in := r.Intersect(i.Bounds())
-	return float64(i.Sum(r)) / float64(in.Dx()*in.Dy())
+	if in.Empty() {
+		return 0, false
+	}
+	return i.Mean(in), true
 }
 
 // Sum returns the sum of all pixels in a section of an image
@@ -198,19 +411,326 @@ func (i SqImage) Sum(r image.Rectangle) uint64 {
 	return Image(i).Sum(r)
 }
 
-// Mean returns the average value of pixels in a section of an image
+// SumSquares returns the exact sum of the squares of all pixels in
+// a section of an image. It is the same as Sum, but named to make
+// clear what is being summed.
+func (i SqImage) SumSquares(r image.Rectangle) uint64 {
+	return Image(i).Sum(r)
+}
+
+// Mean returns the average value of the squares of pixels in a
+// section of an image
 func (i SqImage) Mean(r image.Rectangle) float64 {
 	return Image(i).Mean(r)
 }
 
 // MeanStdDev calculates the mean and standard deviation of a
 // section of an image, using the corresponding regular and square
-// integral images.
+// integral images. This is the population standard deviation, which
+// treats the section as the whole population, dividing by its number
+// of pixels N; see MeanStdDevSample for the sample standard
+// deviation.
+//
+// i and sq must be made from the same image; if they have different
+// bounds MeanStdDev panics. MeanStdDevChecked returns an error
+// instead.
 func MeanStdDev(i Image, sq SqImage, r image.Rectangle) (float64, float64) {
-	imean := i.Mean(r)
-	smean := sq.Mean(r)
+	checkPair(i, sq)
+	// the section is clamped once and used for both images, rather
+	// than calling Mean on each
+	in := r.Intersect(i.Bounds())
+	area := float64(in.Dx() * in.Dy())
+	imean := float64(i.sumIn(in)) / area
+	smean := float64(Image(sq).sumIn(in)) / area
 
 	variance := smean - (imean * imean)
 
 	return imean, math.Sqrt(variance)
 }
+
+// MeanStdDevChecked calculates the mean and standard deviation of a
+// section of an image, as with MeanStdDev, but returns an error
+// wrapping ErrBoundsMismatch if i and sq have different bounds, rather
+// than panicking.
+func MeanStdDevChecked(i Image, sq SqImage, r image.Rectangle) (float64, float64, error) {
+	if !samePair(i, sq) {
+		return 0, 0, fmt.Errorf("%w: image %v and square image %v", ErrBoundsMismatch, dims(i), dims(Image(sq)))
+	}
+	mean, stddev := MeanStdDev(i, sq, r)
+	return mean, stddev, nil
+}
+
+// samePair returns whether an integral image and square integral image
+// have the same bounds, as they must if they were made from the same
+// image.
+func samePair(i Image, sq SqImage) bool {
+	iw, ih := i.Dims()
+	sw, sh := Image(sq).Dims()
+	return iw == sw && ih == sh
+}
+
+// checkPair panics if an integral image and square integral image
+// have different bounds.
+func checkPair(i Image, sq SqImage) {
+	if !samePair(i, sq) {
+		panic("integral: image and square image have different bounds")
+	}
+}
+
+// checkSizes panics if any of a set of tables, given by their sizes,
+// is not the same size as the first. what names the tables in the
+// panic message.
+func checkSizes(what string, sizes ...image.Point) {
+	for _, s := range sizes[1:] {
+		if s != sizes[0] {
+			panic("integral: " + what + " have different bounds")
+		}
+	}
+}
+
+// dims returns the size of an image as a point, for use in errors.
+func dims(i Image) image.Point {
+	w, h := i.Dims()
+	return image.Pt(w, h)
+}
+
+// MeanStdDevSample calculates the mean and sample standard deviation
+// of a section of an image, using the corresponding regular and
+// square integral images. The sample standard deviation treats the
+// section as a sample of a larger population, applying Bessel's
+// correction by dividing by N-1 rather than N, where N is the number
+// of pixels in the section within the image. It is therefore larger
+// than that given by MeanStdDev, especially for small sections. If
+// the section has fewer than two pixels the standard deviation is
+// NaN. As with MeanStdDev, it panics if i and sq have different
+// bounds.
+func MeanStdDevSample(i Image, sq SqImage, r image.Rectangle) (float64, float64) {
+	checkPair(i, sq)
+	in := r.Intersect(i.Bounds())
+	n := float64(in.Dx() * in.Dy())
+	if n < 2 {
+		return i.Mean(in), math.NaN()
+	}
+	sum := float64(i.Sum(in))
+	mean := sum / n
+	variance := (float64(sq.Sum(in)) - sum*mean) / (n - 1)
+	if variance < 0 {
+		// guard against rounding errors for very uniform sections
+		variance = 0
+	}
+	return mean, math.Sqrt(variance)
+}
+
+// SubImage returns an integral image of the section r of the image
+// covered by i, clipped to its bounds. As with every integral image
+// its bounds start at (0, 0), so coordinates in the returned image
+// are relative to r.Min; for example its Sum(image.Rect(0, 0, 1, 1))
+// is the value of the pixel at r.Min in i.
+//
+// Unlike the SubImage methods of the standard library image types,
+// the returned image does not share storage with i, as the prefix
+// sums need rebasing to exclude the pixels above and to the left of
+// r. This is done directly from the sums already in i, so it is much
+// cheaper than building a new integral image from the source.
+func (i Image) SubImage(r image.Rectangle) Image {
+	r = r.Intersect(i.Bounds())
+	sub := *NewImage(r)
+	for y := range sub {
+		for x := range sub[y] {
+			px := image.Rect(r.Min.X, r.Min.Y, r.Min.X+x+1, r.Min.Y+y+1)
+			sub[y][x] = i.Sum(px)
+		}
+	}
+	return sub
+}
+
+// RowSums returns the sum of each row of an image, from top to
+// bottom. This is the horizontal projection profile of the image.
+func (i Image) RowSums() []uint64 {
+	b := i.Bounds()
+	sums := make([]uint64, b.Dy())
+	for y := range sums {
+		sums[y] = i.Sum(image.Rect(b.Min.X, y, b.Max.X, y+1))
+	}
+	return sums
+}
+
+// ColumnSums returns the sum of each column of an image, from left
+// to right. This is the vertical projection profile of the image.
+func (i Image) ColumnSums() []uint64 {
+	b := i.Bounds()
+	sums := make([]uint64, b.Dx())
+	for x := range sums {
+		sums[x] = i.Sum(image.Rect(x, b.Min.Y, x+1, b.Max.Y))
+	}
+	return sums
+}
+
+// SumBatch returns the sums of many sections of an image, in the
+// same order as they are given. The sums are calculated in parallel,
+// split between as many goroutines as there are CPUs available, which
+// is safe as long as the image is not modified while it runs.
+func (i Image) SumBatch(rs []image.Rectangle) []uint64 {
+	sums := make([]uint64, len(rs))
+	workers := runtime.GOMAXPROCS(0)
+	chunk := (len(rs) + workers - 1) / workers
+	var wg sync.WaitGroup
+	for start := 0; start < len(rs); start += chunk {
+		end := lowest(start+chunk, len(rs))
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			for n := start; n < end; n++ {
+				sums[n] = i.Sum(rs[n])
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	return sums
+}
+
+// Visualize returns an image of the integral table itself, rather
+// than the original image which At reconstructs, for inspection when
+// debugging. The prefix sums are scaled so that the largest is white;
+// for a valid table this is the one at the bottom right, so the image
+// is a gradient from the top left, growing brighter more quickly where
+// the original is bright. The largest value is found by scanning the
+// whole table rather than assumed to be at the bottom right, so that
+// tables which have gone wrong can be visualized too.
+func (i Image) Visualize() *image.Gray16 {
+	b := i.Bounds()
+	out := image.NewGray16(b)
+	var max uint64
+	for _, row := range i {
+		for _, v := range row {
+			if v > max {
+				max = v
+			}
+		}
+	}
+	if max == 0 {
+		return out
+	}
+	for y, row := range i {
+		for x, v := range row {
+			hi, lo := bits.Mul64(v, 0xffff)
+			scaled, _ := bits.Div64(hi, lo, max)
+			out.SetGray16(x, y, color.Gray16{uint16(scaled)})
+		}
+	}
+	return out
+}
+
+// Original returns the image which the integral image was made from,
+// reconstructed in a single pass. This gives the same result as
+// calling At for every pixel, but is faster, as each row is only
+// compared with the one above it once. Values which do not fit in 16
+// bits are truncated, as with At.
+func (i Image) Original() *image.Gray16 {
+	b := i.Bounds()
+	out := image.NewGray16(b)
+	var above []uint64
+	for y, row := range i {
+		var prev, prevAbove uint64
+		for x, v := range row {
+			var a uint64
+			if above != nil {
+				a = above[x]
+			}
+			// the difference between this row and the one above is
+			// the sum of the row up to and including this pixel
+			orig := (v - a) - (prev - prevAbove)
+			out.SetGray16(x, y, color.Gray16{uint16(orig)})
+			prev, prevAbove = v, a
+		}
+		above = row
+	}
+	return out
+}
+
+// Transpose returns a new integral image of the original image
+// flipped along its diagonal, so that its Sum over a section with x
+// and y swapped is equal to the Sum of i over the original section.
+// This can be useful for algorithms which work column by column, as
+// those become cache friendly row by row accesses.
+//
+// No recalculation is needed, as the sum of the pixels above and to
+// the left of a point in the transposed image is the sum of the same
+// pixels in the original, just with the axes swapped; so the prefix
+// sums are simply transposed themselves.
+func (i Image) Transpose() Image {
+	b := i.Bounds()
+	t := *NewImage(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y, row := range i {
+		for x, v := range row {
+			t[x][y] = v
+		}
+	}
+	return t
+}
+
+// AddImages returns a new integral image of the pixelwise sum of the
+// images that imgs were made from, for example to accumulate a stack
+// of aligned frames. As integration is linear, the integral image of
+// a sum of images is the sum of their integral images, so this simply
+// adds the prefix sums together. An error wrapping ErrBoundsMismatch
+// is returned if the images have different bounds. If no images are
+// given the result is nil.
+//
+// Note that the sums wrap on overflow, which only becomes possible
+// with very large images or a very large number of them.
+func AddImages(imgs ...Image) (Image, error) {
+	if len(imgs) == 0 {
+		return nil, nil
+	}
+	b := imgs[0].Bounds()
+	for _, i := range imgs[1:] {
+		if !i.Bounds().Eq(b) {
+			return nil, fmt.Errorf("%w: %v and %v", ErrBoundsMismatch, b, i.Bounds())
+		}
+	}
+	sum := *NewImage(b)
+	for _, i := range imgs {
+		for y, row := range i {
+			for x, v := range row {
+				sum[y][x] += v
+			}
+		}
+	}
+	return sum, nil
+}
+
+// Equal returns whether two integral images are identical, having
+// the same bounds and values. As an integral image is determined by
+// the image it was made from, this is also whether the two original
+// images are the same.
+func Equal(a, b Image) bool {
+	return ApproxEqual(a, b, 0)
+}
+
+// ApproxEqual returns whether two integral images have the same
+// bounds and values which differ by no more than tol. This is useful
+// for comparing integral images made by methods which round slightly
+// differently, such as those converted from float images. Note that
+// tol applies to the integral values themselves, which are sums of
+// many pixels, rather than to the pixels of the original images.
+func ApproxEqual(a, b Image, tol uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for y := range a {
+		if len(a[y]) != len(b[y]) {
+			return false
+		}
+		for x, v := range a[y] {
+			d := v - b[y][x]
+			if b[y][x] > v {
+				d = b[y][x] - v
+			}
+			if d > tol {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -5,9 +5,12 @@
 package integral
 
 import (
+	"errors"
 	"image"
+	"image/color"
 	"image/draw"
 	_ "image/png"
+	"math"
 	"os"
 	"testing"
 )
@@ -119,6 +122,14 @@ func TestMean(t *testing.T) {
 		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
 		{"toosmall", image.Rect(-1, -1, 4, 5)},
 		{"small2", image.Rect(0, 0, 4, 4)},
+		{"pastleft", image.Rect(-10, 5, 20, 30)},
+		{"pasttop", image.Rect(5, -10, 20, 30)},
+		{"pastright", image.Rect(50, 5, b.Max.X+10, 30)},
+		{"pastbottom", image.Rect(5, 50, 20, b.Max.Y+10)},
+		{"pastalledges", image.Rect(-3, -3, b.Max.X+3, b.Max.Y+3)},
+		{"pastbottomright", image.Rect(60, 80, b.Max.X+25, b.Max.Y+40)},
+		{"widerthanimage", image.Rect(-50, 10, b.Max.X+50, 20)},
+		{"tallerthanimage", image.Rect(10, -50, 20, b.Max.Y+50)},
 	}
 
 	for _, c := range cases {
@@ -128,6 +139,83 @@ func TestMean(t *testing.T) {
 			if meanimg != meanint {
 				t.Errorf("Mean of integral image differs to regular image: regular: %f, integral: %f\n", meanimg, meanint)
 			}
+			// the sum and the area must both be of the same clamped
+			// section
+			in := c.r.Intersect(b)
+			if integral.Sum(c.r) != integral.Sum(in) {
+				t.Errorf("Sum not clamped to image: clamped: %d, unclamped: %d\n", integral.Sum(in), integral.Sum(c.r))
+			}
+			expected := float64(integral.Sum(in)) / float64(in.Dx()*in.Dy())
+			if meanint != expected {
+				t.Errorf("Mean wrong: expected %f, got %f\n", expected, meanint)
+			}
+		})
+	}
+}
+
+func TestThinImages(t *testing.T) {
+	shapes := []struct {
+		name string
+		b    image.Rectangle
+	}{
+		{"row", image.Rect(0, 0, 20, 1)},
+		{"column", image.Rect(0, 0, 1, 20)},
+		{"pixel", image.Rect(0, 0, 1, 1)},
+		{"offsetrow", image.Rect(5, 7, 25, 8)},
+	}
+
+	for _, s := range shapes {
+		img := image.NewGray16(s.b)
+		n := 0
+		for y := s.b.Min.Y; y < s.b.Max.Y; y++ {
+			for x := s.b.Min.X; x < s.b.Max.X; x++ {
+				img.SetGray16(x, y, color.Gray16{uint16(n*1000 + 7)})
+				n++
+			}
+		}
+		imgplus := newGray16Plus(img.Bounds().Sub(s.b.Min))
+		draw.Draw(imgplus, imgplus.Bounds(), img, s.b.Min, draw.Src)
+		integral := NewImage(s.b)
+		draw.Draw(integral, integral.Bounds(), img, s.b.Min, draw.Src)
+		b := integral.Bounds()
+
+		cases := []struct {
+			name string
+			r    image.Rectangle
+		}{
+			{"fullimage", b},
+			{"first", image.Rect(0, 0, 1, 1)},
+			{"last", image.Rect(b.Max.X-1, b.Max.Y-1, b.Max.X, b.Max.Y)},
+			{"partial", image.Rect(0, 0, lowest(b.Max.X, 3), lowest(b.Max.Y, 3))},
+			{"middle", image.Rect(b.Max.X/2, b.Max.Y/2, b.Max.X, b.Max.Y)},
+			{"toobig", image.Rect(-5, -5, 50, 50)},
+			{"pastend", image.Rect(b.Max.X/2, b.Max.Y/2, 50, 50)},
+			{"outside", image.Rect(30, 30, 40, 40)},
+		}
+
+		for _, c := range cases {
+			t.Run(s.name+"/"+c.name, func(t *testing.T) {
+				sumimg := imgplus.sum(c.r)
+				sumint := integral.Sum(c.r)
+				if sumimg != sumint {
+					t.Errorf("Sum wrong: expected %d, got %d\n", sumimg, sumint)
+				}
+				if c.r.Intersect(b).Empty() {
+					return
+				}
+				meanimg := imgplus.mean(c.r)
+				meanint := integral.Mean(c.r)
+				if meanimg != meanint {
+					t.Errorf("Mean wrong: expected %f, got %f\n", meanimg, meanint)
+				}
+			})
+		}
+
+		t.Run(s.name+"/subimage", func(t *testing.T) {
+			sub := integral.SubImage(b)
+			if !imgsequal(sub, integral) {
+				t.Errorf("SubImage of whole image differs to original\n")
+			}
 		})
 	}
 }
@@ -183,3 +271,1106 @@ func (i grayPlus) mean(r image.Rectangle) float64 {
 	in := r.Intersect(i.Bounds())
 	return float64(i.sum(r)) / float64(in.Dx()*in.Dy())
 }
+
+func TestSubImage(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	crop := image.Rect(10, 20, 60, 90)
+	sub := integral.SubImage(crop)
+	if !sub.Bounds().Eq(image.Rect(0, 0, crop.Dx(), crop.Dy())) {
+		t.Fatalf("SubImage bounds wrong: %v\n", sub.Bounds())
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", sub.Bounds()},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, crop.Dy())},
+		{"corner", image.Rect(40, 60, 50, 70)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			abs := c.r.Add(crop.Min).Intersect(crop)
+			meansub := sub.Mean(c.r)
+			meanparent := integral.Mean(abs)
+			if meansub != meanparent {
+				t.Errorf("Mean of sub image differs to parent: parent: %f, sub: %f\n", meanparent, meansub)
+			}
+		})
+	}
+
+	cropped := image.NewGray(sub.Bounds())
+	draw.Draw(cropped, sub.Bounds(), img, crop.Min, draw.Src)
+	if !imgsequal(cropped, sub) {
+		t.Errorf("SubImage pixels differ to cropped image\n")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	rows := integral.RowSums()
+	if len(rows) != b.Dy() {
+		t.Fatalf("Wrong number of row sums: expected %d, got %d\n", b.Dy(), len(rows))
+	}
+	for y, sum := range rows {
+		expected := imgplus.sum(image.Rect(b.Min.X, y, b.Max.X, y+1))
+		if sum != expected {
+			t.Errorf("Sum of row %d differs to regular image: regular: %d, integral: %d\n", y, expected, sum)
+		}
+	}
+
+	cols := integral.ColumnSums()
+	if len(cols) != b.Dx() {
+		t.Fatalf("Wrong number of column sums: expected %d, got %d\n", b.Dx(), len(cols))
+	}
+	for x, sum := range cols {
+		expected := imgplus.sum(image.Rect(x, b.Min.Y, x+1, b.Max.Y))
+		if sum != expected {
+			t.Errorf("Sum of column %d differs to regular image: regular: %d, integral: %d\n", x, expected, sum)
+		}
+	}
+}
+
+func TestMeanOK(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		ok   bool
+	}{
+		{"fullimage", b, true},
+		{"small", image.Rect(1, 1, 5, 5), true},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy()), true},
+		{"zeroarea", image.Rect(5, 5, 5, 5), false},
+		{"outside", image.Rect(1000, 1000, 1010, 1010), false},
+		{"negative", image.Rect(-10, -10, -5, -5), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mean, ok := integral.MeanOK(c.r)
+			if ok != c.ok {
+				t.Fatalf("MeanOK ok wrong: expected %v, got %v\n", c.ok, ok)
+			}
+			if ok && mean != integral.Mean(c.r) {
+				t.Errorf("MeanOK differs to Mean: Mean: %f, MeanOK: %f\n", integral.Mean(c.r), mean)
+			}
+			if !ok && !math.IsNaN(integral.Mean(c.r)) {
+				t.Errorf("Mean of empty section is not NaN: %f\n", integral.Mean(c.r))
+			}
+		})
+	}
+}
+
+func TestMeanGray8(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"single", image.Rect(30, 40, 31, 41)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expected := uint8(math.Round(integral.Mean(c.r) / 257))
+			mean := integral.MeanGray8(c.r)
+			if mean != expected {
+				t.Errorf("MeanGray8 wrong: expected %d, got %d\n", expected, mean)
+			}
+		})
+	}
+
+	g := img.(*image.Gray).GrayAt(30, 40).Y
+	if m := integral.MeanGray8(image.Rect(30, 40, 31, 41)); m != g {
+		t.Errorf("MeanGray8 of single pixel differs to original: original: %d, integral: %d\n", g, m)
+	}
+}
+
+// batchRects returns n pseudo-random sections of an image with the
+// given bounds, some of which extend beyond it.
+func batchRects(b image.Rectangle, n int) []image.Rectangle {
+	rs := make([]image.Rectangle, n)
+	for j := range rs {
+		x, y := (j*7919)%(b.Dx()+10)-5, (j*104729)%(b.Dy()+10)-5
+		rs[j] = image.Rect(x, y, x+j%40+1, y+j%25+1)
+	}
+	return rs
+}
+
+func TestSumBatch(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	for _, n := range []int{0, 1, 7, 1000} {
+		rs := batchRects(b, n)
+		sums := integral.SumBatch(rs)
+		if len(sums) != n {
+			t.Fatalf("Wrong number of sums: expected %d, got %d\n", n, len(sums))
+		}
+		for j, r := range rs {
+			if sums[j] != integral.Sum(r) {
+				t.Errorf("Batch sum %d differs to Sum: Sum: %d, batch: %d\n", j, integral.Sum(r), sums[j])
+			}
+		}
+	}
+}
+
+func BenchmarkSumSerial(b *testing.B) {
+	bounds := image.Rect(0, 0, 1000, 1000)
+	integral := NewImage(bounds)
+	rs := batchRects(bounds, 100000)
+	sums := make([]uint64, len(rs))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for j, r := range rs {
+			sums[j] = integral.Sum(r)
+		}
+	}
+}
+
+func BenchmarkSumBatch(b *testing.B) {
+	bounds := image.Rect(0, 0, 1000, 1000)
+	integral := NewImage(bounds)
+	rs := batchRects(bounds, 100000)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		integral.SumBatch(rs)
+	}
+}
+
+func TestVisualize(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	v := integral.Visualize()
+	if !v.Bounds().Eq(b) {
+		t.Fatalf("Visualization bounds differ: expected %v, got %v\n", b, v.Bounds())
+	}
+	if c := v.Gray16At(b.Max.X-1, b.Max.Y-1).Y; c != 0xffff {
+		t.Errorf("Bottom right of visualization is not white: %d\n", c)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := v.Gray16At(x, y).Y
+			if x > 0 && c < v.Gray16At(x-1, y).Y {
+				t.Fatalf("Visualization decreases from left at %d,%d\n", x, y)
+			}
+			if y > 0 && c < v.Gray16At(x, y-1).Y {
+				t.Fatalf("Visualization decreases from above at %d,%d\n", x, y)
+			}
+		}
+	}
+
+	black := NewImage(image.Rect(0, 0, 3, 3)).Visualize()
+	if c := black.Gray16At(2, 2).Y; c != 0 {
+		t.Errorf("Visualization of black image is not black: %d\n", c)
+	}
+
+	bad := Image{{5, 1 << 63}, {6, 1}}.Visualize()
+	if c := bad.Gray16At(1, 0).Y; c != 0xffff {
+		t.Errorf("Largest value of non-monotonic table is not white: %d\n", c)
+	}
+	if c := bad.Gray16At(1, 1).Y; c != 0 {
+		t.Errorf("Smallest value of non-monotonic table is not black: %d\n", c)
+	}
+}
+
+func TestReset(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	first := &(*integral)[b.Dy()-1][0]
+
+	integral.Reset(b)
+	if !integral.Bounds().Eq(b) {
+		t.Fatalf("Bounds after reset wrong: expected %v, got %v\n", b, integral.Bounds())
+	}
+	if &(*integral)[b.Dy()-1][0] != first {
+		t.Errorf("Rows were reallocated when resetting to the same bounds\n")
+	}
+	if s := integral.Sum(b); s != 0 {
+		t.Errorf("Sum after reset is not zero: %d\n", s)
+	}
+
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	fresh := NewImage(b)
+	draw.Draw(fresh, b, img, b.Min, draw.Src)
+	if integral.Sum(b) != fresh.Sum(b) {
+		t.Errorf("Sum of reused image differs to new image: new: %d, reused: %d\n", fresh.Sum(b), integral.Sum(b))
+	}
+
+	small := image.Rect(0, 0, 10, 20)
+	integral.Reset(small)
+	if !integral.Bounds().Eq(small) {
+		t.Fatalf("Bounds after shrinking reset wrong: expected %v, got %v\n", small, integral.Bounds())
+	}
+	if s := integral.Sum(small); s != 0 {
+		t.Errorf("Sum after shrinking reset is not zero: %d\n", s)
+	}
+
+	integral.Reset(b)
+	if &(*integral)[b.Dy()-1][0] != first {
+		t.Errorf("Rows were reallocated when growing back to the original bounds\n")
+	}
+
+	big := image.Rect(0, 0, b.Dx()+5, b.Dy()+5)
+	integral.Reset(big)
+	if !integral.Bounds().Eq(big) {
+		t.Fatalf("Bounds after growing reset wrong: expected %v, got %v\n", big, integral.Bounds())
+	}
+	if s := integral.Sum(big); s != 0 {
+		t.Errorf("Sum after growing reset is not zero: %d\n", s)
+	}
+}
+
+func TestZero(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	first := &(*integral)[b.Dy()-1][0]
+	if integral.Total() == 0 {
+		t.Fatalf("Total of drawn image is zero\n")
+	}
+
+	integral.Zero()
+	if !integral.Bounds().Eq(b) {
+		t.Fatalf("Bounds after zeroing wrong: expected %v, got %v\n", b, integral.Bounds())
+	}
+	if &(*integral)[b.Dy()-1][0] != first {
+		t.Errorf("Rows were reallocated when zeroing\n")
+	}
+	if s := integral.Total(); s != 0 {
+		t.Errorf("Total after zeroing is not zero: %d\n", s)
+	}
+}
+
+func TestSumSquares(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	sq := NewSqImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	// Drawing the square integral image back out gives the original
+	// pixels, as At can't hold their squares, so integrating that
+	// again would give the sum of pixels, not of their squares.
+	roundtrip := newGray16Plus(b)
+	draw.Draw(roundtrip, b, sq, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 4, 5)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var expected uint64
+			in := c.r.Intersect(b)
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					v := uint64(imgplus.Gray16At(x, y).Y)
+					expected += v * v
+				}
+			}
+			if s := sq.SumSquares(c.r); s != expected {
+				t.Errorf("SumSquares wrong: expected %d, got %d\n", expected, s)
+			}
+			if s := roundtrip.sum(c.r); s != imgplus.sum(c.r) {
+				t.Errorf("Round trip through At differs to original pixels: original: %d, round trip: %d\n", imgplus.sum(c.r), s)
+			}
+		})
+	}
+}
+
+func TestSumStrict(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		err  bool
+	}{
+		{"fullimage", b, false},
+		{"small", image.Rect(1, 1, 5, 5), false},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy()), false},
+		{"toosmall", image.Rect(-1, -1, 4, 5), false},
+		{"faroutside", image.Rect(5000, 5000, 5010, 5010), true},
+		{"negative", image.Rect(-20, -20, -10, -10), true},
+		{"empty", image.Rect(5, 5, 5, 5), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sum, err := integral.SumStrict(c.r)
+			if c.err {
+				if !errors.Is(err, ErrOutOfBounds) {
+					t.Errorf("Expected out of bounds error, got %v\n", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v\n", err)
+			}
+			if sum != integral.Sum(c.r) {
+				t.Errorf("SumStrict differs to Sum: Sum: %d, SumStrict: %d\n", integral.Sum(c.r), sum)
+			}
+		})
+	}
+}
+
+func TestTotal(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	if integral.Total() != integral.Sum(integral.Bounds()) {
+		t.Errorf("Total differs to Sum of whole image: Sum: %d, Total: %d\n", integral.Sum(integral.Bounds()), integral.Total())
+	}
+
+	var empty Image
+	if empty.Total() != 0 {
+		t.Errorf("Total of empty image is not zero: %d\n", empty.Total())
+	}
+}
+
+func TestOriginal(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	if !imgsequal(img, integral.Original()) {
+		t.Errorf("Original differs to source image\n")
+	}
+
+	wide := image.NewGray16(image.Rect(0, 0, 30, 20))
+	for n := range wide.Pix {
+		wide.Pix[n] = uint8(n * 113)
+	}
+	integral = NewImage(wide.Bounds())
+	draw.Draw(integral, wide.Bounds(), wide, image.Point{}, draw.Src)
+	if !imgsequal(wide, integral.Original()) {
+		t.Errorf("Original differs to 16 bit source image\n")
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	transposed := integral.Transpose()
+
+	swap := func(r image.Rectangle) image.Rectangle {
+		return image.Rect(r.Min.Y, r.Min.X, r.Max.Y, r.Max.X)
+	}
+
+	if !transposed.Bounds().Eq(swap(b)) {
+		t.Fatalf("Transposed bounds wrong: expected %v, got %v\n", swap(b), transposed.Bounds())
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"wide", image.Rect(3, 40, 90, 45)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 4, 5)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if transposed.Sum(swap(c.r)) != integral.Sum(c.r) {
+				t.Errorf("Sum of transposed image differs: original: %d, transposed: %d\n", integral.Sum(c.r), transposed.Sum(swap(c.r)))
+			}
+		})
+	}
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if transposed.At(y, x) != integral.At(x, y) {
+				t.Fatalf("Transposed pixel at %d,%d differs\n", y, x)
+			}
+		}
+	}
+}
+
+func TestPrefixSumAt(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		p    image.Point
+		want uint64
+	}{
+		{"bottomright", image.Pt(b.Max.X-1, b.Max.Y-1), integral.Total()},
+		{"beyond", image.Pt(b.Max.X+10, b.Max.Y+10), integral.Total()},
+		{"origin", image.Pt(0, 0), integral.Sum(image.Rect(0, 0, 1, 1))},
+		{"middle", image.Pt(30, 40), integral.Sum(image.Rect(0, 0, 31, 41))},
+		{"left", image.Pt(-1, 40), 0},
+		{"above", image.Pt(30, -1), 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if v := integral.PrefixSumAt(c.p.X, c.p.Y); v != c.want {
+				t.Errorf("PrefixSumAt wrong: expected %d, got %d\n", c.want, v)
+			}
+		})
+	}
+}
+
+func TestAddImages(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	g := grayValues(img)
+	ramp := func(x, y int) uint64 { return uint64(x*100 + y) }
+	a := fromImage(img)
+	c := newFromValues(b.Dx(), b.Dy(), ramp)
+	expected := newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		return uint64(g[y][x]) + ramp(x, y)
+	})
+
+	sum, err := AddImages(*a, *c)
+	if err != nil {
+		t.Fatalf("AddImages failed: %v\n", err)
+	}
+	for y, row := range *expected {
+		for x, v := range row {
+			if sum[y][x] != v {
+				t.Fatalf("AddImages wrong at %d,%d: expected %v, got %v\n", x, y, v, sum[y][x])
+			}
+		}
+	}
+	r := image.Rect(10, 20, 50, 60)
+	if got, want := sum.Sum(r), a.Sum(r)+c.Sum(r); got != want {
+		t.Errorf("Sum of added images wrong: expected %v, got %v\n", want, got)
+	}
+
+	_, err = AddImages(*a, *NewImage(image.Rect(0, 0, 10, 10)))
+	if !errors.Is(err, ErrBoundsMismatch) {
+		t.Errorf("AddImages with different bounds: expected ErrBoundsMismatch, got %v\n", err)
+	}
+
+	if none, err := AddImages(); none != nil || err != nil {
+		t.Errorf("AddImages with no images: expected nil, nil, got %v, %v\n", none, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Image {
+		return *newFromValues(5, 4, func(x, y int) uint64 {
+			return uint64(x + y)
+		})
+	}
+
+	cases := []struct {
+		name    string
+		corrupt func(i Image) Image
+		valid   bool
+	}{
+		{"valid", func(i Image) Image { return i }, true},
+		{"empty", func(i Image) Image { return Image{} }, true},
+		{"zeros", func(i Image) Image { return *NewImage(image.Rect(0, 0, 3, 3)) }, true},
+		{"lessThanLeft", func(i Image) Image { i[2][3] = i[2][2] - 1; return i }, false},
+		{"lessThanAbove", func(i Image) Image { i[3][0] = 0; return i }, false},
+		{"flipped", func(i Image) Image { i[0][0] = math.MaxUint64; return i }, false},
+		{"ragged", func(i Image) Image { i[1] = i[1][:3]; return i }, false},
+		{"raggedFirst", func(i Image) Image { i[0] = i[0][:2]; return i }, false},
+		{"raggedLast", func(i Image) Image { i[3] = append(i[3], i[3][4]); return i }, false},
+		{"emptyRow", func(i Image) Image { i[2] = nil; return i }, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.corrupt(valid()).Validate()
+			if c.valid && err != nil {
+				t.Errorf("Validate wrong: expected nil, got %v\n", err)
+			}
+			if !c.valid && !errors.Is(err, ErrInvalid) {
+				t.Errorf("Validate wrong: expected ErrInvalid, got %v\n", err)
+			}
+		})
+	}
+}
+
+func TestMeanStdDev(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+	i, sq := NewMeanStdDevPair(img)
+
+	// every window must give exactly the same result as calculating
+	// from the separate means
+	for y := b.Min.Y - 2; y < b.Max.Y+2; y++ {
+		for x := b.Min.X - 2; x < b.Max.X+2; x++ {
+			r := centredWindow(x, y, 9)
+			mean := i.Mean(r)
+			stddev := math.Sqrt(sq.Mean(r) - mean*mean)
+			m, sd := MeanStdDev(*i, *sq, r)
+			if m != mean || sd != stddev {
+				t.Fatalf("MeanStdDev of %v wrong: expected %f, %f, got %f, %f\n", r, mean, stddev, m, sd)
+			}
+		}
+	}
+
+	if m, sd := MeanStdDev(*i, *sq, image.Rect(200, 200, 300, 300)); !math.IsNaN(m) || !math.IsNaN(sd) {
+		t.Errorf("MeanStdDev outside image wrong: expected NaN, NaN, got %f, %f\n", m, sd)
+	}
+}
+
+func TestMeanStdDevChecked(t *testing.T) {
+	img := image.NewGray16(image.Rect(0, 0, 10, 8))
+	for n := range img.Pix {
+		img.Pix[n] = uint8(n * 17)
+	}
+	i, sq := NewMeanStdDevPair(img)
+	r := image.Rect(2, 2, 7, 6)
+
+	mean, stddev, err := MeanStdDevChecked(*i, *sq, r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+	if m, sd := MeanStdDev(*i, *sq, r); m != mean || sd != stddev {
+		t.Errorf("MeanStdDevChecked wrong: expected %f, %f, got %f, %f\n", m, sd, mean, stddev)
+	}
+
+	mismatched := []struct {
+		name string
+		sq   SqImage
+	}{
+		{"taller", *NewSqImage(image.Rect(0, 0, 10, 9))},
+		{"narrower", *NewSqImage(image.Rect(0, 0, 9, 8))},
+		{"empty", SqImage{}},
+	}
+
+	for _, c := range mismatched {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := MeanStdDevChecked(*i, c.sq, r)
+			if !errors.Is(err, ErrBoundsMismatch) {
+				t.Errorf("Expected bounds mismatch error, got %v\n", err)
+			}
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MeanStdDev did not panic with mismatched images\n")
+				}
+			}()
+			MeanStdDev(*i, c.sq, r)
+		})
+	}
+}
+
+func TestMeanStdDevSample(t *testing.T) {
+	v := []uint16{2, 4, 4, 4, 5, 5, 7, 9}
+	img := image.NewGray16(image.Rect(0, 0, 4, 3))
+	for n, c := range v {
+		img.SetGray16(n%4, n/4, color.Gray16{c})
+	}
+	i, sq := NewMeanStdDevPair(img)
+
+	cases := []struct {
+		name              string
+		r                 image.Rectangle
+		mean, pop, sample float64
+	}{
+		{"known", image.Rect(0, 0, 4, 2), 5, 2, math.Sqrt(32.0 / 7)},
+		{"pair", image.Rect(2, 1, 4, 2), 8, 1, math.Sqrt2},
+		{"flat", image.Rect(1, 0, 4, 1), 4, 0, 0},
+		{"zeros", image.Rect(0, 2, 4, 3), 0, 0, 0},
+		{"single", image.Rect(3, 1, 4, 2), 9, 0, math.NaN()},
+		{"toobig", image.Rect(-5, -5, 4, 2), 5, 2, math.Sqrt(32.0 / 7)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mean, pop := MeanStdDev(*i, *sq, c.r)
+			smean, sample := MeanStdDevSample(*i, *sq, c.r)
+			if mean != c.mean || smean != c.mean {
+				t.Errorf("Mean wrong: expected %f, got %f and %f\n", c.mean, mean, smean)
+			}
+			if math.Abs(pop-c.pop) > 1e-9 {
+				t.Errorf("Population standard deviation wrong: expected %f, got %f\n", c.pop, pop)
+			}
+			if math.IsNaN(c.sample) != math.IsNaN(sample) || math.Abs(sample-c.sample) > 1e-9 {
+				t.Errorf("Sample standard deviation wrong: expected %f, got %f\n", c.sample, sample)
+			}
+		})
+	}
+
+	if _, sample := MeanStdDevSample(*i, *sq, image.Rect(10, 10, 20, 20)); !math.IsNaN(sample) {
+		t.Errorf("Sample standard deviation outside image wrong: expected NaN, got %f\n", sample)
+	}
+}
+
+func TestSumArea(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		area int
+	}{
+		{"fullimage", b, b.Dx() * b.Dy()},
+		{"small", image.Rect(1, 1, 5, 5), 16},
+		{"pastright", image.Rect(90, 5, 100, 10), 4 * 5},
+		{"pastbottomright", image.Rect(90, 110, 200, 200), 4 * 7},
+		{"pastalledges", image.Rect(-3, -3, b.Max.X+3, b.Max.Y+3), b.Dx() * b.Dy()},
+		{"outside", image.Rect(200, 200, 300, 300), 0},
+		{"inverted", image.Rectangle{image.Pt(10, 10), image.Pt(5, 5)}, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sum, area := integral.SumArea(c.r)
+			if area != c.area {
+				t.Errorf("Area wrong: expected %d, got %d\n", c.area, area)
+			}
+			if expected := imgplus.sum(c.r.Intersect(b)); sum != expected {
+				t.Errorf("Sum wrong: expected %d, got %d\n", expected, sum)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	base := func() Image {
+		return *newFromValues(5, 4, func(x, y int) uint64 {
+			return uint64(x*10 + y)
+		})
+	}
+
+	cases := []struct {
+		name   string
+		change func(i Image) Image
+		tol    uint64
+		equal  bool
+		approx bool
+	}{
+		{"same", func(i Image) Image { return i }, 0, true, true},
+		{"empty", func(i Image) Image { return Image{} }, 10, false, false},
+		{"smaller", func(i Image) Image { return i[:3] }, 10, false, false},
+		{"narrower", func(i Image) Image { i[2] = i[2][:4]; return i }, 10, false, false},
+		{"withinTol", func(i Image) Image { i[1][2] += 3; return i }, 3, false, true},
+		{"belowWithinTol", func(i Image) Image { i[3][4] -= 3; return i }, 3, false, true},
+		{"outsideTol", func(i Image) Image { i[1][2] += 4; return i }, 3, false, false},
+		{"belowOutsideTol", func(i Image) Image { i[0][0] -= 4; return i }, 3, false, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, b := base(), c.change(base())
+			if e := Equal(a, b); e != c.equal {
+				t.Errorf("Equal wrong: expected %v, got %v\n", c.equal, e)
+			}
+			if e := ApproxEqual(a, b, c.tol); e != c.approx {
+				t.Errorf("ApproxEqual wrong: expected %v, got %v\n", c.approx, e)
+			}
+			if e := ApproxEqual(b, a, c.tol); e != c.approx {
+				t.Errorf("ApproxEqual reversed wrong: expected %v, got %v\n", c.approx, e)
+			}
+		})
+	}
+
+	if !Equal(Image{}, Image{}) {
+		t.Errorf("Empty images not equal\n")
+	}
+}
+
+func TestDims(t *testing.T) {
+	cases := []struct {
+		name string
+		i    Image
+		w, h int
+	}{
+		{"nil", nil, 0, 0},
+		{"empty", Image{}, 0, 0},
+		{"noColumns", *NewImage(image.Rect(0, 0, 0, 3)), 0, 3},
+		{"image", *NewImage(image.Rect(5, 5, 12, 9)), 7, 4},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w, h := c.i.Dims(); w != c.w || h != c.h {
+				t.Errorf("Dims wrong: expected %d, %d, got %d, %d\n", c.w, c.h, w, h)
+			}
+		})
+	}
+}
+
+func TestSetGray16(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	gray := image.NewGray16(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+
+	drawn := NewImage(b)
+	draw.Draw(drawn, b, gray, b.Min, draw.Src)
+	set := NewImage(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			set.SetGray16(x, y, gray.Gray16At(x, y).Y)
+		}
+	}
+
+	if !imgsequal(img, drawn) || !imgsequal(img, set) {
+		t.Errorf("Integral image built from Gray16 differs to original\n")
+	}
+}
+
+// newBenchGray16 returns a Gray16 image with a pattern of values.
+func newBenchGray16() *image.Gray16 {
+	img := image.NewGray16(image.Rect(0, 0, 1000, 1000))
+	for n := range img.Pix {
+		img.Pix[n] = uint8(n * 7)
+	}
+	return img
+}
+
+func BenchmarkDrawGray16(b *testing.B) {
+	img := newBenchGray16()
+	integral := NewImage(img.Bounds())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		draw.Draw(integral, img.Bounds(), img, image.Point{}, draw.Src)
+	}
+}
+
+func BenchmarkDrawRGBA(b *testing.B) {
+	img := image.NewRGBA(image.Rect(0, 0, 1000, 1000))
+	draw.Draw(img, img.Bounds(), newBenchGray16(), image.Point{}, draw.Src)
+	integral := NewImage(img.Bounds())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		draw.Draw(integral, img.Bounds(), img, image.Point{}, draw.Src)
+	}
+}
+
+func BenchmarkSetGray16(b *testing.B) {
+	img := newBenchGray16()
+	bounds := img.Bounds()
+	integral := NewImage(bounds)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				integral.SetGray16(x, y, img.Gray16At(x, y).Y)
+			}
+		}
+	}
+}
+
+func FuzzSum(f *testing.F) {
+	img := image.NewGray16(image.Rect(0, 0, 7, 5))
+	for n := range img.Pix {
+		img.Pix[n] = uint8(n*31 + 7)
+	}
+	b := img.Bounds()
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	f.Add(0, 0, 7, 5)
+	f.Add(1, 1, 3, 4)
+	f.Add(-1, -1, 4, 5)
+	f.Add(5, 5, 2, 2)
+	f.Add(3, -4, 100, 2)
+	f.Add(-10, -10, -5, -5)
+	f.Fuzz(func(t *testing.T, x0, y0, x1, y1 int) {
+		// not made with image.Rect, so may be inverted
+		r := image.Rectangle{image.Pt(x0, y0), image.Pt(x1, y1)}
+		var expected uint64
+		in := r.Intersect(b)
+		for y := in.Min.Y; y < in.Max.Y; y++ {
+			for x := in.Min.X; x < in.Max.X; x++ {
+				expected += uint64(img.Gray16At(x, y).Y)
+			}
+		}
+		if sum := integral.Sum(r); sum != expected {
+			t.Errorf("Sum of %v wrong: expected %d, got %d\n", r, expected, sum)
+		}
+		if sum := integral.SumXY(x0, y0, x1, y1); sum != expected {
+			t.Errorf("SumXY of %v wrong: expected %d, got %d\n", r, expected, sum)
+		}
+		if in.Empty() {
+			if m := integral.Mean(r); !math.IsNaN(m) {
+				t.Errorf("Mean of %v wrong: expected NaN, got %f\n", r, m)
+			}
+			return
+		}
+		mean := float64(expected) / float64(in.Dx()*in.Dy())
+		if m := integral.Mean(r); m != mean {
+			t.Errorf("Mean of %v wrong: expected %f, got %f\n", r, mean, m)
+		}
+	})
+}
+
+// slidingMeanStdDev calls fn for a window around every pixel of an
+// image the size of the test image.
+func slidingMeanStdDev(b *testing.B, fn func(i Image, sq SqImage, r image.Rectangle) (float64, float64)) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		b.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		b.Fatalf("Could not decode image: %v\n", err)
+	}
+	i, sq := NewMeanStdDevPair(img)
+	bounds := img.Bounds()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				fn(*i, *sq, centredWindow(x, y, 15))
+			}
+		}
+	}
+}
+
+func BenchmarkMeanStdDev(b *testing.B) {
+	slidingMeanStdDev(b, MeanStdDev)
+}
+
+func BenchmarkMeanStdDevSeparate(b *testing.B) {
+	slidingMeanStdDev(b, func(i Image, sq SqImage, r image.Rectangle) (float64, float64) {
+		mean := i.Mean(r)
+		variance := sq.Mean(r) - mean*mean
+		return mean, math.Sqrt(variance)
+	})
+}
+
+func BenchmarkSum(b *testing.B) {
+	i := newFromValues(500, 500, func(x, y int) uint64 { return uint64(x ^ y) })
+	b.ResetTimer()
+	var total uint64
+	for n := 0; n < b.N; n++ {
+		for y := 0; y < 500; y++ {
+			for x := 0; x < 500; x++ {
+				total += i.Sum(image.Rect(x-7, y-7, x+8, y+8))
+			}
+		}
+	}
+}
+
+func BenchmarkSumXY(b *testing.B) {
+	i := newFromValues(500, 500, func(x, y int) uint64 { return uint64(x ^ y) })
+	b.ResetTimer()
+	var total uint64
+	for n := 0; n < b.N; n++ {
+		for y := 0; y < 500; y++ {
+			for x := 0; x < 500; x++ {
+				total += i.SumXY(x-7, y-7, x+8, y+8)
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// CubeImage is a Cubed integral image, for which the cube of each
+// pixel is saved. Along with QuadImage, this is useful for
+// calculating the skewness and kurtosis of sections of an image.
+//
+// The cube of a 16 bit value needs 48 bits, so a table of them would
+// overflow a uint64 after about 65 thousand pixels, and the fourth
+// power of a single pixel can overflow one. CubeImage and QuadImage
+// are therefore backed by float64 values, which do not overflow for
+// any realistic size of image, but which are only precise to about
+// 16 significant figures, so sums over very large images lose some
+// of their least significant digits.
+type CubeImage FloatImage
+
+// QuadImage is an integral image for which the fourth power of each
+// pixel is saved. See CubeImage for details.
+type QuadImage FloatImage
+
+// NewCubeImage returns a new cubed integral image with the given
+// bounds.
+func NewCubeImage(r image.Rectangle) *CubeImage {
+	i := NewFloatImage(r)
+	c := CubeImage(*i)
+	return &c
+}
+
+// NewQuadImage returns a new fourth power integral image with the
+// given bounds.
+func NewQuadImage(r image.Rectangle) *QuadImage {
+	i := NewFloatImage(r)
+	q := QuadImage(*i)
+	return &q
+}
+
+func (i CubeImage) ColorModel() color.Model { return color.Gray16Model }
+
+func (i CubeImage) Bounds() image.Rectangle {
+	return FloatImage(i).Bounds()
+}
+
+// At returns the colour of the original pixel at a point,
+// approximately. It is recovered from the difference between large
+// float64 sums, so for dark pixels far into a large image the error
+// can be significant; it is intended only for display.
+func (i CubeImage) At(x, y int) color.Color {
+	c := FloatImage(i).orig(x, y)
+	return color.Gray16{clampGray16(math.Cbrt(c))}
+}
+
+func (i CubeImage) Set(x, y int, c color.Color) {
+	v := float64(gray16(c))
+	FloatImage(i).set(x, y, v*v*v)
+}
+
+// Sum returns the sum of the cubes of all pixels in a section of an
+// image
+func (i CubeImage) Sum(r image.Rectangle) float64 {
+	return FloatImage(i).Sum(r)
+}
+
+// Mean returns the average value of the cubes of pixels in a section
+// of an image
+func (i CubeImage) Mean(r image.Rectangle) float64 {
+	return FloatImage(i).Mean(r)
+}
+
+func (i QuadImage) ColorModel() color.Model { return color.Gray16Model }
+
+func (i QuadImage) Bounds() image.Rectangle {
+	return FloatImage(i).Bounds()
+}
+
+// At returns the colour of the original pixel at a point,
+// approximately. See CubeImage.At for details.
+func (i QuadImage) At(x, y int) color.Color {
+	c := FloatImage(i).orig(x, y)
+	return color.Gray16{clampGray16(math.Sqrt(math.Sqrt(math.Max(c, 0))))}
+}
+
+func (i QuadImage) Set(x, y int, c color.Color) {
+	v := float64(gray16(c))
+	FloatImage(i).set(x, y, v*v*v*v)
+}
+
+// Sum returns the sum of the fourth powers of all pixels in a
+// section of an image
+func (i QuadImage) Sum(r image.Rectangle) float64 {
+	return FloatImage(i).Sum(r)
+}
+
+// Mean returns the average value of the fourth powers of pixels in
+// a section of an image
+func (i QuadImage) Mean(r image.Rectangle) float64 {
+	return FloatImage(i).Mean(r)
+}
+
+// Moments calculates the mean, variance, skewness and kurtosis of a
+// section of an image, using the corresponding regular, square, cubed
+// and fourth power integral images. The kurtosis is the plain fourth
+// standardised moment, which is 3 for a normal distribution, rather
+// than the excess kurtosis. If the section is uniform, so the
+// variance is 0, the skewness and kurtosis are returned as 0. It
+// panics if the images do not all have the same bounds.
+func Moments(i Image, sq SqImage, cube CubeImage, quad QuadImage, r image.Rectangle) (mean, variance, skewness, kurtosis float64) {
+	checkPair(i, sq)
+	checkSizes("image and cube or fourth power images", dims(i), floatDims(FloatImage(cube)), floatDims(FloatImage(quad)))
+	m1 := i.Mean(r)
+	m2 := sq.Mean(r)
+	m3 := cube.Mean(r)
+	m4 := quad.Mean(r)
+
+	mean = m1
+	variance = m2 - m1*m1
+	if variance <= 0 {
+		return mean, 0, 0, 0
+	}
+	mu3 := m3 - 3*m1*m2 + 2*m1*m1*m1
+	mu4 := m4 - 4*m1*m3 + 6*m1*m1*m2 - 3*m1*m1*m1*m1
+	skewness = mu3 / math.Pow(variance, 1.5)
+	kurtosis = mu4 / (variance * variance)
+	return mean, variance, skewness, kurtosis
+}
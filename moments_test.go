@@ -0,0 +1,119 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestMoments(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	cube := NewCubeImage(b)
+	quad := NewQuadImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+	draw.Draw(cube, b, img, b.Min, draw.Src)
+	draw.Draw(quad, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"middle", image.Rect(20, 30, 60, 90)},
+		{"toosmall", image.Rect(-1, -1, 30, 40)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			in := c.r.Intersect(b)
+			n := float64(in.Dx() * in.Dy())
+			var m float64
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					m += float64(imgplus.Gray16At(x, y).Y)
+				}
+			}
+			m /= n
+			var m2, m3, m4 float64
+			for y := in.Min.Y; y < in.Max.Y; y++ {
+				for x := in.Min.X; x < in.Max.X; x++ {
+					d := float64(imgplus.Gray16At(x, y).Y) - m
+					m2 += d * d
+					m3 += d * d * d
+					m4 += d * d * d * d
+				}
+			}
+			m2, m3, m4 = m2/n, m3/n, m4/n
+			var skew, kurt float64
+			if m2 > 0 {
+				skew, kurt = m3/math.Pow(m2, 1.5), m4/(m2*m2)
+			}
+
+			mean, variance, skewness, kurtosis := Moments(*integral, *sq, *cube, *quad, c.r)
+			for _, v := range []struct {
+				name      string
+				want, got float64
+			}{
+				{"mean", m, mean},
+				{"variance", m2, variance},
+				{"skewness", skew, skewness},
+				{"kurtosis", kurt, kurtosis},
+			} {
+				if math.Abs(v.got-v.want) > 1e-6*math.Max(1, math.Abs(v.want)) {
+					t.Errorf("%s wrong: expected %f, got %f\n", v.name, v.want, v.got)
+				}
+			}
+		})
+	}
+}
+
+func TestMomentsMismatched(t *testing.T) {
+	b := image.Rect(0, 0, 10, 8)
+	other := image.Rect(0, 0, 10, 9)
+	i, sq := *NewImage(b), *NewSqImage(b)
+	cube, quad := *NewCubeImage(b), *NewQuadImage(b)
+
+	cases := []struct {
+		name string
+		cube CubeImage
+		quad QuadImage
+	}{
+		{"cube", *NewCubeImage(other), quad},
+		{"quad", cube, *NewQuadImage(other)},
+		{"empty", cube, QuadImage{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Moments did not panic with mismatched images\n")
+				}
+			}()
+			Moments(i, sq, c.cube, c.quad, b)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"math"
+)
+
+// SumRects returns the sum of all pixels in a set of sections of an
+// image, which is useful for regions which are not rectangular but
+// can be broken down into rectangles. The sections should not
+// overlap, as any pixels in more than one section are counted more
+// than once; Overlapping can be used to check for this.
+func (i Image) SumRects(rs []image.Rectangle) uint64 {
+	var sum uint64
+	for _, r := range rs {
+		sum += i.Sum(r)
+	}
+	return sum
+}
+
+// Overlapping returns whether any of a set of rectangles overlap
+// each other.
+func Overlapping(rs []image.Rectangle) bool {
+	for n, r := range rs {
+		for _, r2 := range rs[n+1:] {
+			if r.Overlaps(r2) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SumWrap returns the sum of all pixels in a section of an image,
+// treating the image as toroidal, so that any part of the section
+// beyond one edge wraps around to the opposite side, as for a tiled
+// texture. The section is split along each axis into the part before
+// the edge it crosses and the part wrapped from the other side, so a
+// section crossing both a vertical and a horizontal edge is summed as
+// up to four rectangles, each with Sum. Sections wider or taller than
+// the image wrap more than once, so pixels are counted once for each
+// time the section covers them.
+func (i Image) SumWrap(r image.Rectangle) uint64 {
+	w, h := i.Dims()
+	if w == 0 || h == 0 {
+		return 0
+	}
+	var sum uint64
+	for _, sy := range wrapSpans(r.Min.Y, r.Max.Y, h) {
+		for _, sx := range wrapSpans(r.Min.X, r.Max.X, w) {
+			sum += sx.n * sy.n * i.SumXY(sx.lo, sy.lo, sx.hi, sy.hi)
+		}
+	}
+	return sum
+}
+
+// wrapSpan is a range of coordinates, from lo up to but not including
+// hi, which is covered n times.
+type wrapSpan struct {
+	lo, hi int
+	n      uint64
+}
+
+// wrapSpans splits a range of coordinates, from lo up to but not
+// including hi, into the spans it covers within 0 to size when it
+// wraps around at each end.
+func wrapSpans(lo, hi, size int) []wrapSpan {
+	if lo >= hi {
+		return nil
+	}
+	var spans []wrapSpan
+	if reps := (hi - lo) / size; reps > 0 {
+		spans = append(spans, wrapSpan{0, size, uint64(reps)})
+	}
+	start := ((lo % size) + size) % size
+	end := start + (hi-lo)%size
+	if end > start {
+		spans = append(spans, wrapSpan{start, lowest(end, size), 1})
+	}
+	if end > size {
+		spans = append(spans, wrapSpan{0, end - size, 1})
+	}
+	return spans
+}
+
+// SumRotated returns the approximate sum of the pixels in a w by h
+// rectangle centred on a point, rotated about it by angle radians.
+// Positive angles turn clockwise, as y increases downwards. The point
+// is a corner of a pixel, so with no rotation the rectangle covers
+// exactly w by h pixels; where w or h is odd, the extra pixel is on
+// the left or top side of the point.
+//
+// The rectangle is split into horizontal strips one pixel high, each
+// of which is summed with Sum, so this takes time proportional to the
+// height of the rotated rectangle rather than constant time. A pixel
+// is counted in full if its centre is within the rectangle, and not
+// at all otherwise, so the sum differs from the exact area weighted
+// one by at most the pixels which the edges of the rectangle cross,
+// of which there are around 2(w+h). The rectangle includes its near
+// edges but not its far ones, as an image.Rectangle does, so for
+// rotations which are a multiple of 90 degrees it covers exactly w by
+// h pixels and the error is zero. Parts of the rectangle outside of
+// the image are ignored.
+func (i Image) SumRotated(center image.Point, w, h int, angle float64) uint64 {
+	width, height := i.Dims()
+	sin, cos := math.Sincos(angle)
+	hw, hh := float64(w)/2, float64(h)/2
+	ext := math.Abs(hw*sin) + math.Abs(hh*cos)
+	cx, cy := float64(center.X), float64(center.Y)
+
+	var sum uint64
+	y0 := highest(int(math.Floor(cy-ext)), 0)
+	y1 := lowest(int(math.Ceil(cy+ext)), height)
+	for y := y0; y < y1; y++ {
+		dy := float64(y) + 0.5 - cy
+		// a point dx, dy from the centre is within the rectangle if
+		// -hw <= dx*cos + dy*sin < hw and -hh <= dy*cos - dx*sin < hh
+		a0, a1 := pixelSpan(cos, dy*sin, hw, 0.5-cx, width)
+		b0, b1 := pixelSpan(-sin, dy*cos, hh, 0.5-cx, width)
+		sum += i.SumXY(highest(a0, b0), y, lowest(a1, b1), y+1)
+	}
+	return sum
+}
+
+// pixelSpan returns the range of x, from x0 up to but not including
+// x1, for which -c <= a*(x+off) + b < c. The range is limited to
+// between 0 and n; if there are no such x, x0 is not less than x1.
+func pixelSpan(a, b, c, off float64, n int) (x0, x1 int) {
+	if math.Abs(a) < 1e-12 {
+		if -c <= b && b < c {
+			return 0, n
+		}
+		return 0, 0
+	}
+	lo, hi := (-c-b)/a-off, (c-b)/a-off
+	if a > 0 {
+		// lo <= x < hi
+		return pixelBound(lo, n, math.Ceil), pixelBound(hi, n, math.Ceil)
+	}
+	// hi < x <= lo
+	return pixelBound(hi, n, math.Floor) + 1, pixelBound(lo, n, math.Floor) + 1
+}
+
+// pixelBound rounds v to a whole number with round, after clamping it
+// to between -1 and n+1 so that it fits in an int. Values within
+// rounding error of a whole number are taken to be that number, so
+// that edges which fall exactly between pixels, as they do for
+// rotations which are multiples of 90 degrees, are not moved by a
+// pixel due to the inexactness of the sine and cosine.
+func pixelBound(v float64, n int, round func(float64) float64) int {
+	v = math.Max(-1, math.Min(v, float64(n+1)))
+	if r := math.Round(v); math.Abs(v-r) < 1e-9 {
+		v = r
+	}
+	return int(round(v))
+}
+
+// MeanCircle returns the mean of the pixels in a circle around a
+// pixel, being those whose distance from it is no more than radius.
+// The circle is split into horizontal strips one pixel high, each of
+// which is summed with Sum, so the result is exact for this set of
+// pixels, rather than an approximation, but takes time proportional
+// to the radius. Only the part of the circle within the bounds of the
+// image is considered, for both the sum and the number of pixels it
+// is divided by. If no pixels of the circle are within the image the
+// mean is NaN.
+func (i Image) MeanCircle(center image.Point, radius int) float64 {
+	b := i.Bounds()
+	var sum uint64
+	var n int
+	for dy := -radius; dy <= radius; dy++ {
+		hw := isqrt(radius*radius - dy*dy)
+		y := center.Y + dy
+		r := image.Rect(center.X-hw, y, center.X+hw+1, y+1).Intersect(b)
+		sum += i.Sum(r)
+		n += r.Dx() * r.Dy()
+	}
+	return float64(sum) / float64(n)
+}
+
+// MeanAnnulus returns the mean of the pixels in a square ring around
+// a pixel, being those in the box of outerRadius around it but not in
+// the box of innerRadius around it, where a box of radius r is 2r+1
+// pixels wide. This is useful for estimating the background around a
+// feature. Both boxes are clamped to the bounds of the image before
+// their sums and areas are subtracted, so only pixels of the ring
+// within the image are considered. If there are none, including when
+// innerRadius is not less than outerRadius, the mean is NaN. A
+// negative innerRadius gives the mean of the whole outer box.
+func (i Image) MeanAnnulus(center image.Point, innerRadius, outerRadius int) float64 {
+	box := func(r int) image.Rectangle {
+		if r < 0 {
+			return image.Rectangle{}
+		}
+		return image.Rect(center.X-r, center.Y-r, center.X+r+1, center.Y+r+1)
+	}
+	innerRadius = lowest(innerRadius, outerRadius)
+	outer, outerArea := i.SumArea(box(outerRadius))
+	inner, innerArea := i.SumArea(box(innerRadius))
+	return float64(outer-inner) / float64(outerArea-innerArea)
+}
+
+// QuadrantMeans returns the means of the four quadrants of the image:
+// top left, top right, bottom left and bottom right. The image is
+// split at half its width and height, rounded down, so if either is
+// odd the right or bottom quadrants are one pixel wider or taller
+// than the others. Quadrants with no pixels, as for an image less
+// than 2 pixels wide or tall, have a mean of NaN.
+func (i Image) QuadrantMeans() (tl, tr, bl, br float64) {
+	b := i.Bounds()
+	mid := image.Pt(b.Dx()/2, b.Dy()/2)
+	tl = i.Mean(image.Rect(0, 0, mid.X, mid.Y))
+	tr = i.Mean(image.Rect(mid.X, 0, b.Max.X, mid.Y))
+	bl = i.Mean(image.Rect(0, mid.Y, mid.X, b.Max.Y))
+	br = i.Mean(image.Rect(mid.X, mid.Y, b.Max.X, b.Max.Y))
+	return tl, tr, bl, br
+}
+
+// isqrt returns the largest integer whose square is no more than n.
+func isqrt(n int) int {
+	r := int(math.Sqrt(float64(n)))
+	for r*r > n {
+		r--
+	}
+	for (r+1)*(r+1) <= n {
+		r++
+	}
+	return r
+}
+
+// ThresholdRegions returns a coarse set of regions of the image which
+// are brighter than a threshold, for use as candidate areas to
+// process further. The image is split into gridSize by gridSize
+// blocks, with the last blocks in each direction being smaller if the
+// size of the image is not divisible by gridSize, and those whose mean
+// is above meanThreshold are kept. Kept blocks which touch each other
+// horizontally or vertically are joined, and the bounding rectangle
+// of each group is returned, in order of the top left most block of
+// each group. Note that a bounding rectangle can include blocks which
+// were not kept, if a group is not itself rectangular.
+func (i Image) ThresholdRegions(gridSize int, meanThreshold float64) []image.Rectangle {
+	gridSize = highest(gridSize, 1)
+	b := i.Bounds()
+	w := (b.Dx() + gridSize - 1) / gridSize
+	h := (b.Dy() + gridSize - 1) / gridSize
+	block := func(x, y int) image.Rectangle {
+		return image.Rect(x*gridSize, y*gridSize, (x+1)*gridSize, (y+1)*gridSize).Intersect(b)
+	}
+
+	kept := make([][]bool, h)
+	for y := range kept {
+		kept[y] = make([]bool, w)
+		for x := range kept[y] {
+			kept[y][x] = i.Mean(block(x, y)) > meanThreshold
+		}
+	}
+
+	var regions []image.Rectangle
+	for y := range kept {
+		for x := range kept[y] {
+			if !kept[y][x] {
+				continue
+			}
+			// collect every block joined to this one, marking each as
+			// no longer kept so it is only visited once
+			r := block(x, y)
+			kept[y][x] = false
+			stack := []image.Point{{x, y}}
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				r = r.Union(block(p.X, p.Y))
+				for _, n := range []image.Point{{p.X - 1, p.Y}, {p.X + 1, p.Y}, {p.X, p.Y - 1}, {p.X, p.Y + 1}} {
+					if n.X >= 0 && n.Y >= 0 && n.X < w && n.Y < h && kept[n.Y][n.X] {
+						kept[n.Y][n.X] = false
+						stack = append(stack, n)
+					}
+				}
+			}
+			regions = append(regions, r)
+		}
+	}
+	return regions
+}
+
+// borderDark is the mean value below which a row or column at the
+// edge of an image is taken to be part of a dark scanning border.
+const borderDark = 0x4000
+
+// ContentRect returns the section of the image within any dark
+// borders along its edges, such as those left by a scanner around a
+// page, trimming no more than maxBorder pixels from each edge.
+//
+// Borders are found from the projection profiles of the image. Rows
+// are trimmed from the top and then the bottom while the mean of the
+// row is below a quarter of the 16 bit range, and then columns from
+// the left and right in the same way, with the mean of each column
+// taken over just the rows which remain. Each edge stops at the first
+// row or column which is not dark. As whole rows and columns are
+// considered, dark content near an edge, such as a heading in bold
+// type, is only trimmed if it fills most of the width or height. At
+// least one row and column are always kept.
+func (i Image) ContentRect(maxBorder int) image.Rectangle {
+	r := i.Bounds()
+	dark := func(s image.Rectangle) bool {
+		return i.Mean(s) < borderDark
+	}
+	for n := 0; n < maxBorder && r.Dy() > 1 && dark(image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+1)); n++ {
+		r.Min.Y++
+	}
+	for n := 0; n < maxBorder && r.Dy() > 1 && dark(image.Rect(r.Min.X, r.Max.Y-1, r.Max.X, r.Max.Y)); n++ {
+		r.Max.Y--
+	}
+	for n := 0; n < maxBorder && r.Dx() > 1 && dark(image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y)); n++ {
+		r.Min.X++
+	}
+	for n := 0; n < maxBorder && r.Dx() > 1 && dark(image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y)); n++ {
+		r.Max.X--
+	}
+	return r
+}
@@ -0,0 +1,409 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestSumRects(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name    string
+		rs      []image.Rectangle
+		union   image.Rectangle
+		overlap bool
+	}{
+		{"side", []image.Rectangle{image.Rect(10, 10, 30, 40), image.Rect(30, 10, 50, 40)}, image.Rect(10, 10, 50, 40), false},
+		{"stacked", []image.Rectangle{image.Rect(5, 0, 20, 10), image.Rect(5, 10, 20, 60), image.Rect(5, 60, 20, 61)}, image.Rect(5, 0, 20, 61), false},
+		{"overlapping", []image.Rectangle{image.Rect(10, 10, 30, 40), image.Rect(20, 10, 50, 40)}, image.Rect(10, 10, 50, 40), true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if o := Overlapping(c.rs); o != c.overlap {
+				t.Fatalf("Overlapping wrong: expected %v, got %v\n", c.overlap, o)
+			}
+			sum := integral.SumRects(c.rs)
+			if c.overlap {
+				if sum <= integral.Sum(c.union) {
+					t.Errorf("Overlapping pixels not counted twice: union: %d, rects: %d\n", integral.Sum(c.union), sum)
+				}
+				return
+			}
+			if sum != integral.Sum(c.union) {
+				t.Errorf("Sum of rects differs to sum of union: union: %d, rects: %d\n", integral.Sum(c.union), sum)
+			}
+		})
+	}
+}
+
+func TestSumWrap(t *testing.T) {
+	w, h := 7, 5
+	v := func(x, y int) uint64 { return uint64(x*10 + y + 1) }
+	i := newFromValues(w, h, v)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"inside", image.Rect(1, 1, 4, 3)},
+		{"right", image.Rect(5, 1, 9, 4)},
+		{"bottom", image.Rect(2, 3, 5, 8)},
+		{"corner", image.Rect(4, 3, 10, 7)},
+		{"negative", image.Rect(-2, -1, 3, 2)},
+		{"farout", image.Rect(15, -9, 17, -7)},
+		{"wider", image.Rect(3, 0, 20, 2)},
+		{"whole", image.Rect(0, 0, w, h)},
+		{"empty", image.Rect(6, 2, 6, 9)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var expected uint64
+			for y := c.r.Min.Y; y < c.r.Max.Y; y++ {
+				for x := c.r.Min.X; x < c.r.Max.X; x++ {
+					expected += v(((x%w)+w)%w, ((y%h)+h)%h)
+				}
+			}
+			if s := i.SumWrap(c.r); s != expected {
+				t.Errorf("Sum wrong: expected %d, got %d\n", expected, s)
+			}
+		})
+	}
+}
+
+func TestSumRotated(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name   string
+		center image.Point
+		w, h   int
+		angle  float64
+	}{
+		{"thirty", image.Pt(47, 58), 40, 20, math.Pi / 6},
+		{"negative", image.Pt(40, 60), 31, 17, -math.Pi / 5},
+		{"fortyfive", image.Pt(50, 50), 20, 20, math.Pi / 4},
+		{"clipped", image.Pt(5, 100), 50, 30, math.Pi / 6},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sin, cos := math.Sincos(c.angle)
+			var expected uint64
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					dx := float64(x) + 0.5 - float64(c.center.X)
+					dy := float64(y) + 0.5 - float64(c.center.Y)
+					u, v := dx*cos+dy*sin, dy*cos-dx*sin
+					hw, hh := float64(c.w)/2, float64(c.h)/2
+					if -hw <= u && u < hw && -hh <= v && v < hh {
+						expected += uint64(imgplus.Gray16At(x, y).Y)
+					}
+				}
+			}
+			sum := integral.SumRotated(c.center, c.w, c.h, c.angle)
+			// allow for pixels exactly on the edge being counted
+			// differently
+			diff := math.Abs(float64(sum) - float64(expected))
+			if diff > 2*0xffff {
+				t.Errorf("SumRotated wrong: expected %d, got %d\n", expected, sum)
+			}
+		})
+	}
+
+	axis := []struct {
+		name  string
+		w, h  int
+		angle float64
+		r     image.Rectangle
+	}{
+		{"none", 40, 20, 0, image.Rect(20, 40, 60, 60)},
+		{"right", 40, 20, math.Pi / 2, image.Rect(30, 30, 50, 70)},
+		{"half", 40, 20, math.Pi, image.Rect(20, 40, 60, 60)},
+		{"oddNone", 3, 5, 0, image.Rect(38, 47, 41, 52)},
+		{"oddRight", 3, 5, math.Pi / 2, image.Rect(38, 48, 43, 51)},
+		{"oddHalf", 3, 5, math.Pi, image.Rect(39, 48, 42, 53)},
+		{"oddLeft", 3, 5, -math.Pi / 2, image.Rect(37, 49, 42, 52)},
+		{"oddSquare", 7, 7, math.Pi / 2, image.Rect(37, 46, 44, 53)},
+	}
+
+	ones := newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 { return 1 })
+	for _, c := range axis {
+		t.Run(c.name, func(t *testing.T) {
+			expected := integral.Sum(c.r)
+			if sum := integral.SumRotated(image.Pt(40, 50), c.w, c.h, c.angle); sum != expected {
+				t.Errorf("SumRotated wrong: expected %d, got %d\n", expected, sum)
+			}
+			if n := ones.SumRotated(image.Pt(40, 50), c.w, c.h, c.angle); n != uint64(c.w*c.h) {
+				t.Errorf("Number of pixels summed wrong: expected %d, got %d\n", c.w*c.h, n)
+			}
+		})
+	}
+}
+
+func TestMeanCircle(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name   string
+		center image.Point
+		radius int
+	}{
+		{"middle", image.Pt(47, 58), 20},
+		{"small", image.Pt(30, 30), 3},
+		{"single", image.Pt(10, 90), 0},
+		{"clipped", image.Pt(2, 110), 15},
+		{"toobig", image.Pt(47, 58), 200},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sum uint64
+			var n int
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					dx, dy := x-c.center.X, y-c.center.Y
+					if dx*dx+dy*dy <= c.radius*c.radius {
+						sum += uint64(imgplus.Gray16At(x, y).Y)
+						n++
+					}
+				}
+			}
+			expected := float64(sum) / float64(n)
+			if m := integral.MeanCircle(c.center, c.radius); m != expected {
+				t.Errorf("MeanCircle wrong: expected %f, got %f\n", expected, m)
+			}
+		})
+	}
+
+	if m := integral.MeanCircle(image.Pt(500, 500), 10); !math.IsNaN(m) {
+		t.Errorf("MeanCircle outside image wrong: expected NaN, got %f\n", m)
+	}
+}
+
+func TestThresholdRegions(t *testing.T) {
+	quadrant := image.NewGray(image.Rect(0, 0, 40, 30))
+	draw.Draw(quadrant, image.Rect(20, 15, 40, 30), image.White, image.Point{}, draw.Src)
+
+	separate := image.NewGray(image.Rect(0, 0, 40, 30))
+	draw.Draw(separate, image.Rect(0, 0, 10, 10), image.White, image.Point{}, draw.Src)
+	draw.Draw(separate, image.Rect(25, 5, 35, 25), image.White, image.Point{}, draw.Src)
+	// an L shape, joined into a single region
+	draw.Draw(separate, image.Rect(0, 20, 5, 30), image.White, image.Point{}, draw.Src)
+	draw.Draw(separate, image.Rect(0, 25, 15, 30), image.White, image.Point{}, draw.Src)
+
+	cases := []struct {
+		name     string
+		img      image.Image
+		grid     int
+		expected []image.Rectangle
+	}{
+		{"quadrant", quadrant, 5, []image.Rectangle{image.Rect(20, 15, 40, 30)}},
+		{"quadrantUneven", quadrant, 7, []image.Rectangle{image.Rect(21, 14, 40, 30)}},
+		{"separate", separate, 5, []image.Rectangle{
+			image.Rect(0, 0, 10, 10),
+			image.Rect(25, 5, 35, 25),
+			image.Rect(0, 20, 15, 30),
+		}},
+		{"none", image.NewGray(image.Rect(0, 0, 40, 30)), 5, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			i := fromImage(c.img)
+			got := i.ThresholdRegions(c.grid, 0xffff/2)
+			if len(got) != len(c.expected) {
+				t.Fatalf("Regions wrong: expected %v, got %v\n", c.expected, got)
+			}
+			for n := range got {
+				if !got[n].Eq(c.expected[n]) {
+					t.Errorf("Regions wrong: expected %v, got %v\n", c.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMeanAnnulus(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	imgplus := newGray16Plus(b)
+	integral := NewImage(b)
+	draw.Draw(imgplus, b, img, b.Min, draw.Src)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name         string
+		center       image.Point
+		inner, outer int
+	}{
+		{"middle", image.Pt(47, 58), 5, 12},
+		{"thin", image.Pt(30, 30), 3, 4},
+		{"noinner", image.Pt(30, 30), -1, 4},
+		{"innerpixel", image.Pt(60, 20), 0, 2},
+		{"clipped", image.Pt(2, 110), 4, 15},
+		{"innerclipped", image.Pt(1, 1), 3, 10},
+		{"toobig", image.Pt(47, 58), 10, 200},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var sum uint64
+			var n int
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					dx, dy := x-c.center.X, y-c.center.Y
+					d := highest(highest(dx, -dx), highest(dy, -dy))
+					if d <= c.outer && d > c.inner {
+						sum += uint64(imgplus.Gray16At(x, y).Y)
+						n++
+					}
+				}
+			}
+			expected := float64(sum) / float64(n)
+			if m := integral.MeanAnnulus(c.center, c.inner, c.outer); m != expected {
+				t.Errorf("MeanAnnulus wrong: expected %f, got %f\n", expected, m)
+			}
+		})
+	}
+
+	for _, c := range []struct{ inner, outer int }{{5, 5}, {6, 5}} {
+		if m := integral.MeanAnnulus(image.Pt(40, 40), c.inner, c.outer); !math.IsNaN(m) {
+			t.Errorf("MeanAnnulus with inner radius %d and outer %d wrong: expected NaN, got %f\n", c.inner, c.outer, m)
+		}
+	}
+	if m := integral.MeanAnnulus(image.Pt(500, 500), 2, 10); !math.IsNaN(m) {
+		t.Errorf("MeanAnnulus outside image wrong: expected NaN, got %f\n", m)
+	}
+}
+
+func TestQuadrantMeans(t *testing.T) {
+	cases := []struct {
+		name           string
+		w, h           int
+		tl, tr, bl, br float64
+	}{
+		{"even", 10, 8, 100, 200, 300, 400},
+		{"odd", 11, 9, 100, 200, 300, 400},
+		{"single", 1, 1, math.NaN(), math.NaN(), math.NaN(), 400},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			i := newFromValues(c.w, c.h, func(x, y int) uint64 {
+				v := uint64(100)
+				if x >= c.w/2 {
+					v += 100
+				}
+				if y >= c.h/2 {
+					v += 200
+				}
+				return v
+			})
+			tl, tr, bl, br := i.QuadrantMeans()
+			got := []float64{tl, tr, bl, br}
+			for n, expected := range []float64{c.tl, c.tr, c.bl, c.br} {
+				if got[n] != expected && !(math.IsNaN(got[n]) && math.IsNaN(expected)) {
+					t.Errorf("Mean of quadrant %d wrong: expected %f, got %f\n", n, expected, got[n])
+				}
+			}
+		})
+	}
+}
+
+// newBorderedPage returns a white page with black borders of 3 pixels
+// at the top, 2 at the left and 4 at the right, and a small dark mark
+// within the content.
+func newBorderedPage() *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, 40, 30))
+	draw.Draw(img, image.Rect(2, 3, 36, 30), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 10, 14, 12), image.Black, image.Point{}, draw.Src)
+	return img
+}
+
+func TestContentRect(t *testing.T) {
+	page := newBorderedPage()
+	i := NewImage(page.Bounds())
+	draw.Draw(i, page.Bounds(), page, image.Point{}, draw.Src)
+
+	black := NewImage(image.Rect(0, 0, 10, 10))
+
+	cases := []struct {
+		name      string
+		i         *Image
+		maxBorder int
+		expected  image.Rectangle
+	}{
+		{"borders", i, 10, image.Rect(2, 3, 36, 30)},
+		{"limited", i, 2, image.Rect(2, 2, 38, 30)},
+		{"none", i, 0, image.Rect(0, 0, 40, 30)},
+		{"allDark", black, 20, image.Rect(9, 9, 10, 10)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if r := c.i.ContentRect(c.maxBorder); !r.Eq(c.expected) {
+				t.Errorf("Content rect wrong: expected %v, got %v\n", c.expected, r)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Axis is a direction across an image.
+type Axis int
+
+const (
+	XAxis Axis = iota // horizontal, left to right
+	YAxis             // vertical, top to bottom
+)
+
+// ShadingImage is an integral image together with the auxiliary
+// tables needed to calculate the correlation between pixel values
+// and their position in constant time. These are a squared integral
+// image, and integral images of each pixel value multiplied by its
+// x and y coordinates respectively. The sums of the coordinates
+// themselves, and their squares, are calculated directly, so need
+// no tables. The tables are unexported, and none of them can be set
+// directly, so they cannot get out of step with each other.
+type ShadingImage struct {
+	base   Image
+	sq     SqImage
+	xv, yv Image
+}
+
+// NewShadingImage returns a new ShadingImage for img.
+func NewShadingImage(img image.Image) *ShadingImage {
+	var s ShadingImage
+	s.base = *fromImage(img)
+	s.sq = SqImage(*newFromFunc(img, func(c color.Color) uint64 {
+		v := uint64(gray16(c))
+		return v * v
+	}))
+	s.xv = *newFromFuncXY(img, func(x, y int, c color.Color) uint64 {
+		return uint64(x) * uint64(gray16(c))
+	})
+	s.yv = *newFromFuncXY(img, func(x, y int, c color.Color) uint64 {
+		return uint64(y) * uint64(gray16(c))
+	})
+	return &s
+}
+
+func (s ShadingImage) Bounds() image.Rectangle {
+	return s.base.Bounds()
+}
+
+// Sum returns the sum of all pixels in a section of the image.
+func (s ShadingImage) Sum(r image.Rectangle) uint64 {
+	return s.base.Sum(r)
+}
+
+// Mean returns the average value of pixels in a section of the image.
+func (s ShadingImage) Mean(r image.Rectangle) float64 {
+	return s.base.Mean(r)
+}
+
+// sumTo returns the sum of all integers from 0 to n, and the sum of
+// their squares.
+func sumTo(n int) (float64, float64) {
+	if n < 0 {
+		return 0, 0
+	}
+	f := float64(n)
+	return f * (f + 1) / 2, f * (f + 1) * (2*f + 1) / 6
+}
+
+// ShadingCorrelation returns the Pearson correlation coefficient
+// between pixel values and their position along axis, over a section
+// of an image. A value close to 1 or -1 indicates that the section is
+// dominated by a smooth gradient, such as shading or a shadow, which
+// may be worth removing before thresholding. 0 is returned if either
+// the pixel values or the positions do not vary over the section.
+func (s ShadingImage) ShadingCorrelation(r image.Rectangle, axis Axis) float64 {
+	r = r.Intersect(s.Bounds())
+	lo, hi, other := r.Min.X, r.Max.X, r.Dy()
+	tv := s.xv
+	if axis == YAxis {
+		lo, hi, other = r.Min.Y, r.Max.Y, r.Dx()
+		tv = s.yv
+	}
+
+	n := float64(r.Dx() * r.Dy())
+	sum1, sq1 := sumTo(hi - 1)
+	sum0, sq0 := sumTo(lo - 1)
+	sp := float64(other) * (sum1 - sum0)
+	spp := float64(other) * (sq1 - sq0)
+	sv := float64(s.base.Sum(r))
+	svv := float64(s.sq.Sum(r))
+	spv := float64(tv.Sum(r))
+
+	cov := n*spv - sp*sv
+	vp := n*spp - sp*sp
+	vv := n*svv - sv*sv
+	if vp <= 0 || vv <= 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vp*vv)
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+)
+
+func TestShadingCorrelation(t *testing.T) {
+	ramp := image.NewGray16(image.Rect(0, 0, 16, 8))
+	flat := image.NewGray16(image.Rect(0, 0, 16, 8))
+	noisy := image.NewGray16(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			ramp.SetGray16(x, y, color.Gray16{uint16(60000 - x*1000)})
+			flat.SetGray16(x, y, color.Gray16{30000})
+			noisy.SetGray16(x, y, color.Gray16{uint16(((x * 7919) ^ (y * 104729)) % 65536)})
+		}
+	}
+
+	cases := []struct {
+		name string
+		img  image.Image
+		r    image.Rectangle
+		axis Axis
+		min  float64
+		max  float64
+	}{
+		{"rampx", ramp, ramp.Bounds(), XAxis, -1.0001, -0.9999},
+		{"rampxsection", ramp, image.Rect(3, 2, 9, 7), XAxis, -1.0001, -0.9999},
+		{"rampy", ramp, ramp.Bounds(), YAxis, -0.0001, 0.0001},
+		{"flat", flat, flat.Bounds(), XAxis, 0, 0},
+		{"noisy", noisy, noisy.Bounds(), XAxis, -0.5, 0.5},
+		{"column", ramp, image.Rect(4, 0, 5, 8), XAxis, 0, 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewShadingImage(c.img)
+			corr := s.ShadingCorrelation(c.r, c.axis)
+			if math.IsNaN(corr) || corr < c.min || corr > c.max {
+				t.Errorf("Correlation %f outside of expected range %f - %f\n", corr, c.min, c.max)
+			}
+		})
+	}
+}
+
+func TestShadingImageNotDrawable(t *testing.T) {
+	s := NewShadingImage(image.NewGray16(image.Rect(0, 0, 4, 4)))
+	if _, ok := interface{}(s).(draw.Image); ok {
+		t.Errorf("ShadingImage can be drawn onto, which would only update one of its tables\n")
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"fmt"
+	"image"
+)
+
+// SignedImage is an integral image of int64 values, for source data
+// which can be negative, such as the difference between two images.
+// In an Image negative values would wrap around, breaking any sums
+// which include them. It is simply a GenericImage of int64, so has
+// the same Sum and Mean methods.
+type SignedImage = GenericImage[int64]
+
+// NewSignedFromImages returns a new signed integral image of the 16
+// bit grayscale values of a minus those of b, which should be aligned
+// images, such as consecutive frames of a video. Unlike NewDiffImage
+// the sign of the difference is kept, so regions which have become
+// lighter can be distinguished from those which have become darker.
+// An error wrapping ErrBoundsMismatch is returned if the images have
+// different bounds.
+func NewSignedFromImages(a, b image.Image) (*SignedImage, error) {
+	if !a.Bounds().Eq(b.Bounds()) {
+		return nil, fmt.Errorf("%w: %v and %v", ErrBoundsMismatch, a.Bounds(), b.Bounds())
+	}
+	ga, gb := grayValues(a), grayValues(b)
+	diff := make([][]int64, len(ga))
+	for y := range ga {
+		diff[y] = make([]int64, len(ga[y]))
+		for x := range ga[y] {
+			diff[y][x] = int64(ga[y][x]) - int64(gb[y][x])
+		}
+	}
+	i := NewGenericImage[int64](a.Bounds())
+	i.Load(diff)
+	return i, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestSignedImage(t *testing.T) {
+	b := image.Rect(0, 0, 8, 8)
+	a := image.NewGray16(b)
+	c := image.NewGray16(b)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			a.SetGray16(x, y, color.Gray16{20000})
+			v := uint16(20000)
+			switch {
+			case x < 4 && y >= 4:
+				v = 25000
+			case x >= 4 && y >= 4:
+				v = 5000
+			}
+			c.SetGray16(x, y, color.Gray16{v})
+		}
+	}
+
+	diff, err := NewSignedFromImages(a, c)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v\n", err)
+	}
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		sum  int64
+		mean float64
+	}{
+		{"unchanged", image.Rect(0, 0, 8, 4), 0, 0},
+		{"darker", image.Rect(0, 4, 4, 8), -5000 * 16, -5000},
+		{"lighter", image.Rect(4, 4, 8, 8), 15000 * 16, 15000},
+		{"bottom", image.Rect(0, 4, 8, 8), 10000 * 16, 5000},
+		{"fullimage", b, 10000 * 16, 2500},
+		{"toobig", image.Rect(-4, 4, 4, 20), -5000 * 16, -5000},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s := diff.Sum(c.r); s != c.sum {
+				t.Errorf("Sum wrong: expected %d, got %d\n", c.sum, s)
+			}
+			if m := diff.Mean(c.r); m != c.mean {
+				t.Errorf("Mean wrong: expected %f, got %f\n", c.mean, m)
+			}
+		})
+	}
+
+	_, err = NewSignedFromImages(a, image.NewGray16(image.Rect(0, 0, 8, 9)))
+	if !errors.Is(err, ErrBoundsMismatch) {
+		t.Errorf("Expected bounds mismatch error, got %v\n", err)
+	}
+}
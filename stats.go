@@ -0,0 +1,185 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// StatImage is an integral image paired with the squared integral
+// image of the same base image, so that the mean and standard
+// deviation of sections of the image can be calculated without
+// needing to keep the two in sync separately. The tables are
+// unexported, and only changed together, by Set, so they cannot get
+// out of step with each other.
+type StatImage struct {
+	i  Image
+	sq SqImage
+}
+
+// NewEmptyStatImage returns a new StatImage with the given bounds, to
+// be drawn onto.
+func NewEmptyStatImage(r image.Rectangle) *StatImage {
+	return &StatImage{i: *NewImage(r), sq: *NewSqImage(r)}
+}
+
+// NewStatImage returns a new StatImage for img, building both
+// integral images in a single pass over it.
+func NewStatImage(img image.Image) *StatImage {
+	b := img.Bounds()
+	s := NewEmptyStatImage(b)
+	for y := 0; y < b.Dy(); y++ {
+		var rowsum, sqrowsum uint64
+		for x := 0; x < b.Dx(); x++ {
+			v := uint64(gray16(img.At(b.Min.X+x, b.Min.Y+y)))
+			rowsum += v
+			sqrowsum += v * v
+			s.i[y][x] = rowsum
+			s.sq[y][x] = sqrowsum
+			if y > 0 {
+				s.i[y][x] += s.i[y-1][x]
+				s.sq[y][x] += s.sq[y-1][x]
+			}
+		}
+	}
+	return s
+}
+
+// NewMeanStdDevPair returns a new integral image and squared integral
+// image of img, for use with MeanStdDev. Both are built in a single
+// pass over img, rather than drawing it onto each separately.
+func NewMeanStdDevPair(img image.Image) (*Image, *SqImage) {
+	s := NewStatImage(img)
+	return &s.i, &s.sq
+}
+
+func (s StatImage) ColorModel() color.Model { return s.i.ColorModel() }
+
+func (s StatImage) Bounds() image.Rectangle {
+	return s.i.Bounds()
+}
+
+func (s StatImage) At(x, y int) color.Color {
+	return s.i.At(x, y)
+}
+
+// Set sets the pixel at a point in both the integral image and the
+// squared integral image.
+func (s StatImage) Set(x, y int, c color.Color) {
+	s.i.Set(x, y, c)
+	s.sq.Set(x, y, c)
+}
+
+// Sum returns the sum of all pixels in a section of the image.
+func (s StatImage) Sum(r image.Rectangle) uint64 {
+	return s.i.Sum(r)
+}
+
+// Mean returns the average value of pixels in a section of the image.
+func (s StatImage) Mean(r image.Rectangle) float64 {
+	return s.i.Mean(r)
+}
+
+// MeanStdDev calculates the mean and standard deviation of a
+// section of the image.
+func (s StatImage) MeanStdDev(r image.Rectangle) (float64, float64) {
+	return MeanStdDev(s.i, s.sq, r)
+}
+
+// Stats returns several statistics for a section of the image, as
+// RegionStats does.
+func (s StatImage) Stats(r image.Rectangle) Stats {
+	return RegionStats(s.i, s.sq, r)
+}
+
+// WeightedMean returns the mean of the pixels in a section of an
+// image which are selected by a mask, by dividing the sum of value by
+// the sum of mask. mask should be an integral image of 1 for each
+// selected pixel and 0 for each pixel which is not, and value an
+// integral image in which the pixels which are not selected are 0,
+// for example one built from the original image multiplied by the
+// mask. If no pixels in the section are selected, false is returned.
+// It panics if value and mask have different bounds.
+func WeightedMean(value, mask Image, r image.Rectangle) (float64, bool) {
+	checkSizes("value and mask images", dims(value), dims(mask))
+	n := mask.Sum(r)
+	if n == 0 {
+		return 0, false
+	}
+	return float64(value.Sum(r)) / float64(n), true
+}
+
+// Stats holds several statistics for a section of an image.
+type Stats struct {
+	Sum      uint64  // sum of all pixels
+	Area     int     // number of pixels within the image
+	Mean     float64 // mean pixel value
+	Variance float64 // variance of the pixel values
+	StdDev   float64 // standard deviation of the pixel values
+}
+
+// RegionStats calculates several statistics for a section of an
+// image together, using the corresponding regular and square integral
+// images. The section is clamped to the bounds of the image once, and
+// the corners of each image are looked up once, so this is cheaper
+// than calling Sum, Mean and MeanStdDev separately. It panics if i
+// and sq have different bounds.
+func RegionStats(i Image, sq SqImage, r image.Rectangle) Stats {
+	checkPair(i, sq)
+	in := r.Intersect(i.Bounds())
+	var s Stats
+	s.Sum = i.sumIn(in)
+	s.Area = in.Dx() * in.Dy()
+	s.Mean = float64(s.Sum) / float64(s.Area)
+	smean := float64(Image(sq).sumIn(in)) / float64(s.Area)
+	s.Variance = smean - (s.Mean * s.Mean)
+	s.StdDev = math.Sqrt(s.Variance)
+	return s
+}
+
+// CoeffVar returns the coefficient of variation of a section of an
+// image, which is its standard deviation divided by its mean. This
+// measures how much the pixels vary relative to their brightness, so
+// is comparable between darker and lighter areas. If the mean is 0,
+// or the section has no pixels within the image, NaN is returned.
+func CoeffVar(i Image, sq SqImage, r image.Rectangle) float64 {
+	mean, stddev := MeanStdDev(i, sq, r)
+	if mean == 0 {
+		return math.NaN()
+	}
+	return stddev / mean
+}
+
+// StdDevMap returns the standard deviation of the window of
+// windowSize by windowSize pixels around each pixel of img, indexed
+// as [y][x] relative to the bounds of img. Windows are clamped to the
+// bounds of the image. Unlike an image of the values, they are
+// neither scaled nor clipped to fit a pixel range, so are suitable
+// for further analysis.
+func StdDevMap(img image.Image, windowSize int) [][]float64 {
+	b := img.Bounds()
+	s := NewStatImage(img)
+	sd := make([][]float64, b.Dy())
+	for y := range sd {
+		sd[y] = make([]float64, b.Dx())
+		for x := range sd[y] {
+			_, sd[y][x] = s.MeanStdDev(centredWindow(x, y, windowSize))
+		}
+	}
+	return sd
+}
+
+// TrimBorders returns a new StatImage of the part of the image within
+// any dark borders along its edges, up to maxBorder pixels thick, as
+// found by ContentRect, so that scanning artifacts do not skew the
+// statistics of the page. As with SubImage, coordinates in the result
+// are relative to the top left of the content, which can be found
+// with ContentRect.
+func (s StatImage) TrimBorders(maxBorder int) StatImage {
+	r := s.i.ContentRect(maxBorder)
+	return StatImage{i: s.i.SubImage(r), sq: SqImage(Image(s.sq).SubImage(r))}
+}
@@ -0,0 +1,345 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestStatImage(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	stat := NewStatImage(img)
+	drawn := NewEmptyStatImage(b)
+	draw.Draw(drawn, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 4, 5)},
+		{"small2", image.Rect(0, 0, 4, 4)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mean, stddev := MeanStdDev(*integral, *sq, c.r)
+			for _, s := range []*StatImage{stat, drawn} {
+				smean, sstddev := s.MeanStdDev(c.r)
+				if smean != mean || sstddev != stddev {
+					t.Errorf("StatImage MeanStdDev differs to separate images: separate: %f, %f, StatImage: %f, %f\n", mean, stddev, smean, sstddev)
+				}
+			}
+		})
+	}
+}
+
+func TestStatImageEncoding(t *testing.T) {
+	s := NewStatImage(newTestPage())
+	b := s.Bounds()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		t.Fatalf("Could not encode StatImage with gob: %v\n", err)
+	}
+	var fromGob StatImage
+	if err := gob.NewDecoder(&buf).Decode(&fromGob); err != nil {
+		t.Fatalf("Could not decode StatImage with gob: %v\n", err)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Could not encode StatImage as JSON: %v\n", err)
+	}
+	var fromJSON StatImage
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("Could not decode StatImage from JSON: %v\n", err)
+	}
+
+	r := image.Rect(3, 4, 20, 30)
+	mean, stddev := s.MeanStdDev(r)
+	for _, s2 := range []StatImage{fromGob, fromJSON} {
+		if !s2.i.Bounds().Eq(b) || !s2.sq.Bounds().Eq(b) {
+			t.Fatalf("Decoded bounds differ: expected %v, got %v and %v\n", b, s2.i.Bounds(), s2.sq.Bounds())
+		}
+		if m, sd := s2.MeanStdDev(r); m != mean || sd != stddev {
+			t.Errorf("MeanStdDev of decoded StatImage differs: original: %f, %f, decoded: %f, %f\n", mean, stddev, m, sd)
+		}
+	}
+
+	mismatched := `{"image":{"width":2,"height":1,"data":[[1,2]]},"sq":{"width":1,"height":1,"data":[[1]]}}`
+	var s3 StatImage
+	if err := json.Unmarshal([]byte(mismatched), &s3); !errors.Is(err, ErrBoundsMismatch) {
+		t.Errorf("Expected bounds mismatch error decoding mismatched tables, got %v\n", err)
+	}
+}
+
+func TestMeanStdDevPair(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	pi, psq := NewMeanStdDevPair(img)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 4, 5)},
+		{"middle", image.Rect(20, 30, 60, 90)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if s, ps := integral.Sum(c.r), pi.Sum(c.r); s != ps {
+				t.Errorf("Sum wrong: expected %d, got %d\n", s, ps)
+			}
+			if s, ps := sq.Sum(c.r), psq.Sum(c.r); s != ps {
+				t.Errorf("Square sum wrong: expected %d, got %d\n", s, ps)
+			}
+			mean, stddev := MeanStdDev(*integral, *sq, c.r)
+			pmean, pstddev := MeanStdDev(*pi, *psq, c.r)
+			if pmean != mean || pstddev != stddev {
+				t.Errorf("MeanStdDev wrong: expected %f, %f, got %f, %f\n", mean, stddev, pmean, pstddev)
+			}
+		})
+	}
+}
+
+func TestWeightedMean(t *testing.T) {
+	v := [][]uint64{
+		{10, 20, 30, 40},
+		{50, 60, 70, 80},
+		{90, 100, 110, 120},
+	}
+	m := [][]uint64{
+		{1, 0, 1, 0},
+		{0, 0, 1, 1},
+		{0, 0, 0, 0},
+	}
+	value := newFromValues(4, 3, func(x, y int) uint64 { return v[y][x] * m[y][x] })
+	mask := newFromValues(4, 3, func(x, y int) uint64 { return m[y][x] })
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		mean float64
+		ok   bool
+	}{
+		{"fullimage", image.Rect(0, 0, 4, 3), (10 + 30 + 70 + 80) / 4.0, true},
+		{"right", image.Rect(2, 0, 4, 2), (30 + 70 + 80) / 3.0, true},
+		{"single", image.Rect(0, 0, 1, 1), 10, true},
+		{"unmasked", image.Rect(0, 2, 4, 3), 0, false},
+		{"outside", image.Rect(10, 10, 20, 20), 0, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mean, ok := WeightedMean(*value, *mask, c.r)
+			if ok != c.ok || mean != c.mean {
+				t.Errorf("WeightedMean wrong: expected %f, %v, got %f, %v\n", c.mean, c.ok, mean, ok)
+			}
+		})
+	}
+}
+
+func TestWeightedMeanMismatched(t *testing.T) {
+	value := newFromValues(4, 3, func(x, y int) uint64 { return 1 })
+	mask := newFromValues(3, 3, func(x, y int) uint64 { return 1 })
+	defer func() {
+		if recover() == nil {
+			t.Errorf("WeightedMean did not panic with mismatched images\n")
+		}
+	}()
+	WeightedMean(*value, *mask, image.Rect(0, 0, 4, 3))
+}
+
+func TestRegionStats(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+		area int
+	}{
+		{"fullimage", b, b.Dx() * b.Dy()},
+		{"small", image.Rect(1, 1, 5, 5), 16},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy()), b.Dx() * b.Dy()},
+		{"toosmall", image.Rect(-1, -1, 4, 5), 20},
+		{"small2", image.Rect(0, 0, 4, 4), 16},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := RegionStats(*integral, *sq, c.r)
+			mean, stddev := MeanStdDev(*integral, *sq, c.r)
+			if s.Sum != integral.Sum(c.r) {
+				t.Errorf("Sum differs: expected %d, got %d\n", integral.Sum(c.r), s.Sum)
+			}
+			if s.Area != c.area {
+				t.Errorf("Area wrong: expected %d, got %d\n", c.area, s.Area)
+			}
+			if s.Mean != integral.Mean(c.r) || s.Mean != mean {
+				t.Errorf("Mean differs: expected %f, got %f\n", mean, s.Mean)
+			}
+			if s.StdDev != stddev {
+				t.Errorf("StdDev differs: expected %f, got %f\n", stddev, s.StdDev)
+			}
+			if s.Variance != stddev*stddev && math.Abs(s.Variance-stddev*stddev) > 1e-6*s.Variance {
+				t.Errorf("Variance differs: expected %f, got %f\n", stddev*stddev, s.Variance)
+			}
+		})
+	}
+}
+
+func TestCoeffVar(t *testing.T) {
+	v := []uint16{2, 4, 4, 4, 5, 5, 7, 9}
+	img := image.NewGray16(image.Rect(0, 0, 4, 3))
+	for n, c := range v {
+		img.SetGray16(n%4, n/4, color.Gray16{c * 1000})
+	}
+	i, sq := NewMeanStdDevPair(img)
+
+	cases := []struct {
+		name     string
+		r        image.Rectangle
+		expected float64
+	}{
+		{"known", image.Rect(0, 0, 4, 2), 2000.0 / 5000},
+		{"flat", image.Rect(1, 0, 4, 1), 0},
+		{"pair", image.Rect(2, 1, 4, 2), 1000.0 / 8000},
+		{"zeromean", image.Rect(0, 2, 4, 3), math.NaN()},
+		{"outside", image.Rect(10, 10, 20, 20), math.NaN()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cv := CoeffVar(*i, *sq, c.r)
+			if math.IsNaN(c.expected) != math.IsNaN(cv) || math.Abs(cv-c.expected) > 1e-9 {
+				t.Errorf("Coefficient of variation wrong: expected %f, got %f\n", c.expected, cv)
+			}
+		})
+	}
+}
+
+func TestStdDevMap(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+	draw.Draw(sq, b, img, b.Min, draw.Src)
+
+	sd := StdDevMap(img, 15)
+	if len(sd) != b.Dy() || len(sd[0]) != b.Dx() {
+		t.Fatalf("Size of map wrong: expected %dx%d, got %dx%d\n", b.Dx(), b.Dy(), len(sd[0]), len(sd))
+	}
+
+	cases := []struct {
+		name string
+		p    image.Point
+		r    image.Rectangle
+	}{
+		{"middle", image.Pt(40, 60), image.Rect(33, 53, 48, 68)},
+		{"topleft", image.Pt(0, 0), image.Rect(0, 0, 8, 8)},
+		{"bottomright", image.Pt(b.Dx()-1, b.Dy()-1), image.Rect(b.Dx()-8, b.Dy()-8, b.Dx(), b.Dy())},
+		{"leftedge", image.Pt(3, 50), image.Rect(0, 43, 11, 58)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, expected := MeanStdDev(*integral, *sq, c.r)
+			if got := sd[c.p.Y][c.p.X]; got != expected {
+				t.Errorf("Standard deviation wrong: expected %f, got %f\n", expected, got)
+			}
+		})
+	}
+}
+
+func TestTrimBorders(t *testing.T) {
+	page := newBorderedPage()
+	s := NewStatImage(page)
+	trimmed := s.TrimBorders(10)
+
+	content := image.Rect(2, 3, 36, 30)
+	expected := NewStatImage(page.SubImage(content))
+	if !trimmed.Bounds().Eq(expected.Bounds()) {
+		t.Fatalf("Bounds of trimmed image wrong: expected %v, got %v\n", expected.Bounds(), trimmed.Bounds())
+	}
+	for _, r := range []image.Rectangle{trimmed.Bounds(), image.Rect(5, 5, 15, 12)} {
+		mean, stddev := expected.MeanStdDev(r)
+		if m, sd := trimmed.MeanStdDev(r); m != mean || sd != stddev {
+			t.Errorf("MeanStdDev of %v wrong: expected %f, %f, got %f, %f\n", r, mean, stddev, m, sd)
+		}
+	}
+	if m, full := trimmed.Mean(trimmed.Bounds()), s.Mean(s.Bounds()); m <= full {
+		t.Errorf("Mean of trimmed image is not lighter than untrimmed: trimmed: %f, untrimmed: %f\n", m, full)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"math"
+)
+
+// SSDMap returns the sum of squared differences between tmpl and each
+// section of img of the same size, for locating tmpl in img. The
+// result is indexed as [y][x], by the position of the top left of
+// each section relative to the top left of img, for every position
+// where tmpl fits entirely within img; the best match is where the
+// value is lowest.
+//
+// The sum of squared differences expands to the sum of the squares
+// of the section, minus twice the correlation of the section and
+// tmpl, plus the sum of the squares of tmpl. Only the first of these
+// is accelerated, by taking it from a squared integral image in
+// constant time; the correlation is still calculated pixel by pixel,
+// and the last is the same for every section.
+func SSDMap(img image.Image, tmpl image.Image) [][]float64 {
+	b := img.Bounds()
+	tb := tmpl.Bounds()
+	g := grayValues(img)
+	tg := grayValues(tmpl)
+	sq := SqImage(*newFromValues(b.Dx(), b.Dy(), func(x, y int) uint64 {
+		v := uint64(g[y][x])
+		return v * v
+	}))
+
+	var tsq uint64
+	for _, row := range tg {
+		for _, v := range row {
+			tsq += uint64(v) * uint64(v)
+		}
+	}
+
+	w, h := b.Dx()-tb.Dx()+1, b.Dy()-tb.Dy()+1
+	if w < 1 || h < 1 {
+		return nil
+	}
+	ssd := make([][]float64, h)
+	for y := range ssd {
+		ssd[y] = make([]float64, w)
+		for x := range ssd[y] {
+			var corr uint64
+			for ty, row := range tg {
+				for tx, v := range row {
+					corr += uint64(g[y+ty][x+tx]) * uint64(v)
+				}
+			}
+			r := image.Rect(x, y, x+tb.Dx(), y+tb.Dy())
+			ssd[y][x] = float64(sq.Sum(r)) - 2*float64(corr) + float64(tsq)
+		}
+	}
+	return ssd
+}
+
+// NCCDenominator returns the part of the denominator of the normalised
+// cross-correlation which depends on the search image, for every
+// windowSize by windowSize section of the image, using its integral
+// and square integral images. The result is indexed as [y][x], by the
+// position of the top left of each section, for every position where
+// the section fits entirely within the image.
+//
+// The denominator of the normalised cross-correlation between a
+// section I and a template T of the same size is
+// √(Σ(I - mean(I))² × Σ(T - mean(T))²). The template term is the same
+// for every section, so each value returned is √(Σ(I - mean(I))²),
+// calculated in constant time as √(ΣI² - (ΣI)²/n), and should be
+// multiplied by the template term to give the full denominator. The
+// numerator still needs to be calculated separately.
+//
+// Sections whose pixels are all the same have a value of 0, for which
+// the normalised cross-correlation is undefined, so callers should
+// check for this before dividing. NCCDenominator panics if i and sq
+// have different bounds.
+func NCCDenominator(i Image, sq SqImage, windowSize int) [][]float64 {
+	checkPair(i, sq)
+	b := i.Bounds()
+	w, h := b.Dx()-windowSize+1, b.Dy()-windowSize+1
+	if windowSize < 1 || w < 1 || h < 1 {
+		return nil
+	}
+	n := float64(windowSize * windowSize)
+	d := make([][]float64, h)
+	for y := range d {
+		d[y] = make([]float64, w)
+		for x := range d[y] {
+			r := image.Rect(x, y, x+windowSize, y+windowSize)
+			sum := float64(i.Sum(r))
+			v := float64(sq.Sum(r)) - sum*sum/n
+			if v > 0 {
+				d[y][x] = math.Sqrt(v)
+			}
+		}
+	}
+	return d
+}
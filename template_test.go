@@ -0,0 +1,118 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/draw"
+	_ "image/png"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestSSDMap(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"middle", image.Rect(30, 40, 45, 52)},
+		{"corner", image.Rect(b.Max.X-8, b.Max.Y-8, b.Max.X, b.Max.Y)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tmpl := image.NewGray(c.r)
+			draw.Draw(tmpl, c.r, img, c.r.Min, draw.Src)
+
+			ssd := SSDMap(img, tmpl)
+			if len(ssd) != b.Dy()-c.r.Dy()+1 || len(ssd[0]) != b.Dx()-c.r.Dx()+1 {
+				t.Fatalf("SSD map has wrong size: %dx%d\n", len(ssd[0]), len(ssd))
+			}
+			best := image.Pt(-1, -1)
+			lowest := -1.0
+			for y, row := range ssd {
+				for x, v := range row {
+					if lowest < 0 || v < lowest {
+						lowest = v
+						best = image.Pt(x, y)
+					}
+				}
+			}
+			if !best.Eq(c.r.Min) || lowest != 0 {
+				t.Errorf("Template found in wrong place: expected %v, got %v with SSD %f\n", c.r.Min, best, lowest)
+			}
+		})
+	}
+
+	if ssd := SSDMap(image.NewGray(image.Rect(0, 0, 4, 4)), image.NewGray(image.Rect(0, 0, 5, 2))); ssd != nil {
+		t.Errorf("SSD map of template larger than image is not nil\n")
+	}
+}
+
+func TestNCCDenominator(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	// make the top left corner flat
+	flat := image.NewGray16(b)
+	draw.Draw(flat, b, img, b.Min, draw.Src)
+	draw.Draw(flat, image.Rect(0, 0, 10, 10), image.White, image.Point{}, draw.Src)
+
+	integral := NewImage(b)
+	sq := NewSqImage(b)
+	draw.Draw(integral, b, flat, b.Min, draw.Src)
+	draw.Draw(sq, b, flat, b.Min, draw.Src)
+
+	const size = 5
+	d := NCCDenominator(*integral, *sq, size)
+	if len(d) != b.Dy()-size+1 || len(d[0]) != b.Dx()-size+1 {
+		t.Fatalf("Denominator map has wrong size: %dx%d\n", len(d[0]), len(d))
+	}
+
+	if d[0][0] != 0 || d[5][5] != 0 {
+		t.Errorf("Denominator of flat region is not zero: %f, %f\n", d[0][0], d[5][5])
+	}
+
+	for _, p := range []image.Point{{20, 30}, {50, 60}, {b.Dx() - size, b.Dy() - size}} {
+		var sum float64
+		for y := p.Y; y < p.Y+size; y++ {
+			for x := p.X; x < p.X+size; x++ {
+				sum += float64(flat.Gray16At(x, y).Y)
+			}
+		}
+		mean := sum / (size * size)
+		var v float64
+		for y := p.Y; y < p.Y+size; y++ {
+			for x := p.X; x < p.X+size; x++ {
+				diff := float64(flat.Gray16At(x, y).Y) - mean
+				v += diff * diff
+			}
+		}
+		expected := math.Sqrt(v)
+		if math.Abs(d[p.Y][p.X]-expected) > 1e-6*math.Max(1, expected) {
+			t.Errorf("Denominator at %v wrong: expected %f, got %f\n", p, expected, d[p.Y][p.X])
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// binarize returns a new black and white image with the bounds of
+// img, where each pixel is white if above returns true for its 16
+// bit grayscale value and position relative to the top left of img.
+func binarize(img image.Image, above func(x, y int, v uint16) bool) *image.Gray {
+	b := img.Bounds()
+	g := grayValues(img)
+	out := image.NewGray(b)
+	for y, row := range g {
+		for x, v := range row {
+			if above(x, y, v) {
+				out.SetGray(b.Min.X+x, b.Min.Y+y, color.Gray{255})
+			}
+		}
+	}
+	return out
+}
+
+// AdaptiveThresholdMean binarizes img by comparing each pixel to the
+// mean of the blockSize by blockSize window around it, minus c,
+// matching the ADAPTIVE_THRESH_MEAN_C method of OpenCV's
+// adaptiveThreshold. Pixels above the threshold are white and the
+// rest black, or the other way around if invert is true.
+//
+// blockSize should be odd, so that the window is centred on the
+// pixel; even sizes are rounded up to the next odd number. Windows
+// are clamped to the bounds of the image, rather than extended by
+// replicating the border pixels as OpenCV does, so results can
+// differ slightly at the edges. c is in the 16 bit grayscale range
+// used throughout this package, so a value used with OpenCV for an 8
+// bit image should be multiplied by 257.
+func AdaptiveThresholdMean(img image.Image, blockSize int, c float64, invert bool) *image.Gray {
+	if blockSize%2 == 0 {
+		blockSize++
+	}
+	i := fromImage(img)
+	return binarize(img, func(x, y int, v uint16) bool {
+		t := i.Mean(centredWindow(x, y, blockSize)) - c
+		return (float64(v) > t) != invert
+	})
+}
+
+// WolfJolion binarizes img using the method of Wolf and Jolion, a
+// variant of Sauvola's method which copes better with faint, low
+// contrast documents. The threshold for each pixel is calculated from
+// the mean m and standard deviation s of the windowSize by windowSize
+// window around it, as
+//
+//	T = (1-k)*m + k*M + k*(s/R)*(m-M)
+//
+// where M is the minimum pixel value in the image and R is the
+// largest standard deviation of any window. Windows are clamped to
+// the bounds of the image, and a windowSize of less than 1 is treated
+// as 1. Pixels above the threshold are white and the rest black. A k
+// of 0.5 is typical.
+func WolfJolion(img image.Image, windowSize int, k float64) *image.Gray {
+	b := img.Bounds()
+	s := NewStatImage(img)
+	g := grayValues(img)
+
+	min := math.Inf(1)
+	var maxStdDev float64
+	means := make([][]float64, b.Dy())
+	stddevs := make([][]float64, b.Dy())
+	for y, row := range g {
+		means[y] = make([]float64, b.Dx())
+		stddevs[y] = make([]float64, b.Dx())
+		for x, v := range row {
+			min = math.Min(min, float64(v))
+			mean, stddev := s.MeanStdDev(centredWindow(x, y, windowSize))
+			means[y][x], stddevs[y][x] = mean, stddev
+			maxStdDev = math.Max(maxStdDev, stddev)
+		}
+	}
+
+	return binarize(img, func(x, y int, v uint16) bool {
+		m, sd := means[y][x], stddevs[y][x]
+		var ratio float64
+		if maxStdDev > 0 {
+			ratio = sd / maxStdDev
+		}
+		t := (1-k)*m + k*min + k*ratio*(m-min)
+		return float64(v) > t
+	})
+}
+
+// Phansalkar binarizes img using the method of Phansalkar et al., a
+// variant of Sauvola's method designed for low contrast images such
+// as stained microscopy slides. The threshold for each pixel is
+// calculated from the mean m and standard deviation s of the
+// windowSize by windowSize window around it, as
+//
+//	T = m * (1 + p*exp(-q*m) + k*(s/r - 1))
+//
+// with values normalised to the range 0-1. Windows are clamped to the
+// bounds of the image. Pixels above the threshold are white and the
+// rest black. If any of k, r, p or q are 0, the values suggested by
+// Phansalkar are used instead: 0.25, 0.5, 2 and 10 respectively.
+func Phansalkar(img image.Image, windowSize int, k, r, p, q float64) *image.Gray {
+	if k == 0 {
+		k = 0.25
+	}
+	if r == 0 {
+		r = 0.5
+	}
+	if p == 0 {
+		p = 2
+	}
+	if q == 0 {
+		q = 10
+	}
+	s := NewStatImage(img)
+	return binarize(img, func(x, y int, v uint16) bool {
+		m, sd := s.MeanStdDev(centredWindow(x, y, windowSize))
+		m, sd = m/0xffff, sd/0xffff
+		t := m * (1 + p*math.Exp(-q*m) + k*(sd/r-1))
+		return float64(v)/0xffff > t
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+	"image/color"
+	_ "image/png"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// newTestPage returns a light page with a shading gradient from
+// left to right, and a dark stroke down the middle.
+func newTestPage() *image.Gray {
+	img := image.NewGray(image.Rect(5, 5, 45, 25))
+	for y := 5; y < 25; y++ {
+		for x := 5; x < 45; x++ {
+			v := uint8(240 - x*2)
+			if x == 24 || x == 25 {
+				v -= 100
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	return img
+}
+
+func TestAdaptiveThresholdMean(t *testing.T) {
+	img := newTestPage()
+
+	cases := []struct {
+		name      string
+		blockSize int
+		invert    bool
+		ink       uint8
+		page      uint8
+	}{
+		{"normal", 7, false, 0, 255},
+		{"inverted", 7, true, 255, 0},
+		{"even", 6, false, 0, 255},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out := AdaptiveThresholdMean(img, c.blockSize, 5*257, c.invert)
+			if !out.Bounds().Eq(img.Bounds()) {
+				t.Fatalf("Output bounds differ: expected %v, got %v\n", img.Bounds(), out.Bounds())
+			}
+			for y := 5; y < 25; y++ {
+				for x := 5; x < 45; x++ {
+					want := c.page
+					if x == 24 || x == 25 {
+						want = c.ink
+					}
+					if v := out.GrayAt(x, y).Y; v != want {
+						t.Fatalf("Pixel at %d,%d wrong: expected %d, got %d\n", x, y, want, v)
+					}
+				}
+			}
+		})
+	}
+
+	odd := AdaptiveThresholdMean(img, 7, 5*257, false)
+	even := AdaptiveThresholdMean(img, 6, 5*257, false)
+	if !imgsequal(odd, even) {
+		t.Errorf("Even block size not rounded up to next odd size\n")
+	}
+}
+
+// countBlack returns the number of black pixels in an image.
+func countBlack(img *image.Gray) int {
+	var n int
+	for _, v := range img.Pix {
+		if v == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestWolfJolion(t *testing.T) {
+	page := newTestPage()
+	out := WolfJolion(page, 7, 0.5)
+	for y := 5; y < 25; y++ {
+		for x := 5; x < 45; x++ {
+			want := uint8(255)
+			if x == 24 || x == 25 {
+				want = 0
+			}
+			if v := out.GrayAt(x, y).Y; v != want {
+				t.Fatalf("Pixel at %d,%d wrong: expected %d, got %d\n", x, y, want, v)
+			}
+		}
+	}
+
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	bin := WolfJolion(img, 15, 0.5)
+	if n := countBlack(bin); n != 1936 {
+		t.Errorf("Number of black pixels in test image changed: expected %d, got %d\n", 1936, n)
+	}
+
+	for _, size := range []int{0, -3} {
+		if !reflect.DeepEqual(WolfJolion(img, size, 0.5), WolfJolion(img, 1, 0.5)) {
+			t.Errorf("Binarized image with window size %d differs to window size 1\n", size)
+		}
+	}
+}
+
+func TestPhansalkar(t *testing.T) {
+	page := newTestPage()
+	out := Phansalkar(page, 7, 0, 0, 0, 0)
+	for y := 5; y < 25; y++ {
+		for x := 5; x < 45; x++ {
+			want := uint8(255)
+			if x == 24 || x == 25 {
+				want = 0
+			}
+			if v := out.GrayAt(x, y).Y; v != want {
+				t.Fatalf("Pixel at %d,%d wrong: expected %d, got %d\n", x, y, want, v)
+			}
+		}
+	}
+
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	bin := Phansalkar(img, 15, 0, 0, 0, 0)
+	if n := countBlack(bin); n != 1978 {
+		t.Errorf("Number of black pixels in test image changed: expected %d, got %d\n", 1978, n)
+	}
+	if !imgsequal(bin, Phansalkar(img, 15, 0.25, 0.5, 2, 10)) {
+		t.Errorf("Default parameters differ to those given explicitly\n")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"image"
+)
+
+// maxTileSize is the largest tile size which a TiledImage can use,
+// being the largest for which the sums of a tile of 16 bit values
+// always fit in 32 bits.
+const maxTileSize = 256
+
+// TiledImage is an integral image which is split into square tiles,
+// for very large images. Each tile holds the integral image of its
+// own pixels in 32 bits, rather than the 64 bits an Image uses, along
+// with running totals of the pixels above and to the left of the
+// tile, from which the full prefix sums can be found. This uses about
+// half as much memory as an Image, and no single allocation is larger
+// than a tile, at the cost of some extra calculation in each Sum.
+type TiledImage struct {
+	w, h  int
+	size  int
+	tiles [][]tile // indexed as [y][x]
+}
+
+// tile is a single tile of a TiledImage.
+type tile struct {
+	corner uint64     // sum of all pixels above and to the left
+	top    []uint64   // sums of pixels above, up to each column
+	left   []uint64   // sums of pixels to the left, up to each row
+	sums   [][]uint32 // integral image of the tile's own pixels
+}
+
+// NewTiledImage returns a new TiledImage of the 16 bit grayscale
+// values of img, split into tiles of tileSize by tileSize pixels. The
+// tile size is clamped to between 1 and 256.
+func NewTiledImage(img image.Image, tileSize int) *TiledImage {
+	size := highest(lowest(tileSize, maxTileSize), 1)
+	b := img.Bounds()
+	t := TiledImage{w: b.Dx(), h: b.Dy(), size: size}
+
+	// sums of each column of pixels above the current row of tiles
+	above := make([]uint64, t.w)
+	for ty := 0; ty*size < t.h; ty++ {
+		th := lowest(size, t.h-ty*size)
+		var row []tile
+		// sums of each row of pixels to the left of the current tile
+		leftOf := make([]uint64, th)
+		var corner uint64
+		for tx := 0; tx*size < t.w; tx++ {
+			tw := lowest(size, t.w-tx*size)
+			x0, y0 := tx*size, ty*size
+			tl := tile{
+				corner: corner,
+				top:    make([]uint64, tw),
+				left:   make([]uint64, th),
+				sums:   make([][]uint32, th),
+			}
+
+			var topsum uint64
+			for x := 0; x < tw; x++ {
+				topsum += above[x0+x]
+				tl.top[x] = topsum
+			}
+			var leftsum uint64
+			for y := 0; y < th; y++ {
+				leftsum += leftOf[y]
+				tl.left[y] = leftsum
+			}
+
+			for y := 0; y < th; y++ {
+				tl.sums[y] = make([]uint32, tw)
+				var rowsum uint32
+				for x := 0; x < tw; x++ {
+					rowsum += uint32(gray16(img.At(b.Min.X+x0+x, b.Min.Y+y0+y)))
+					tl.sums[y][x] = rowsum
+					if y > 0 {
+						tl.sums[y][x] += tl.sums[y-1][x]
+					}
+				}
+				leftOf[y] += uint64(rowsum)
+			}
+
+			corner += topsum
+			row = append(row, tl)
+		}
+
+		for tx := range row {
+			tl := row[tx]
+			for x := range tl.sums[th-1] {
+				col := uint64(tl.sums[th-1][x])
+				if x > 0 {
+					col -= uint64(tl.sums[th-1][x-1])
+				}
+				above[tx*size+x] += col
+			}
+		}
+		t.tiles = append(t.tiles, row)
+	}
+	return &t
+}
+
+func (t TiledImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, t.w, t.h)
+}
+
+// at returns the sum of the pixels above and to the left of a point,
+// inclusive, or 0 if it is above or to the left of the image.
+func (t TiledImage) at(x, y int) uint64 {
+	if x < 0 || y < 0 {
+		return 0
+	}
+	tl := t.tiles[y/t.size][x/t.size]
+	tx, ty := x%t.size, y%t.size
+	return tl.corner + tl.top[tx] + tl.left[ty] + uint64(tl.sums[ty][tx])
+}
+
+// Sum returns the sum of all pixels in a section of an image. Only
+// the part of the section within the bounds of the image is
+// considered.
+func (t TiledImage) Sum(r image.Rectangle) uint64 {
+	r = r.Intersect(t.Bounds())
+	if r.Empty() {
+		return 0
+	}
+	x0, y0, x1, y1 := r.Min.X-1, r.Min.Y-1, r.Max.X-1, r.Max.Y-1
+	return t.at(x1, y1) + t.at(x0, y0) - t.at(x0, y1) - t.at(x1, y0)
+}
+
+// Mean returns the average value of pixels in a section of an image.
+// Only the part of the section within the bounds of the image is
+// considered. If no pixels of the section are within the image the
+// mean is NaN.
+func (t TiledImage) Mean(r image.Rectangle) float64 {
+	in := r.Intersect(t.Bounds())
+	return float64(t.Sum(in)) / float64(in.Dx()*in.Dy())
+}
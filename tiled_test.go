@@ -0,0 +1,73 @@
+// Copyright 2020 Nick White.
+// Use of this source code is governed by the GPLv3
+// license that can be found in the LICENSE file.
+
+package integral
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/png"
+	"os"
+	"testing"
+)
+
+func TestTiledImage(t *testing.T) {
+	f, err := os.Open("testdata/in.png")
+	if err != nil {
+		t.Fatalf("Could not open file %s: %v\n", "testdata/in.png", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Could not decode image: %v\n", err)
+	}
+	b := img.Bounds()
+
+	integral := NewImage(b)
+	draw.Draw(integral, b, img, b.Min, draw.Src)
+
+	cases := []struct {
+		name string
+		r    image.Rectangle
+	}{
+		{"fullimage", b},
+		{"small", image.Rect(1, 1, 5, 5)},
+		{"withintile", image.Rect(17, 17, 30, 30)},
+		{"acrossboundary", image.Rect(10, 10, 20, 20)},
+		{"acrossmany", image.Rect(5, 3, 90, 110)},
+		{"lasttiles", image.Rect(60, 100, 94, 117)},
+		{"toobig", image.Rect(0, 0, 2000, b.Dy())},
+		{"toosmall", image.Rect(-1, -1, 40, 50)},
+		{"single", image.Rect(93, 116, 94, 117)},
+		{"outside", image.Rect(200, 200, 300, 300)},
+	}
+
+	for _, size := range []int{1, 7, 16, 64, 1000} {
+		tiled := NewTiledImage(img, size)
+		for _, c := range cases {
+			t.Run(fmt.Sprintf("%d/%s", size, c.name), func(t *testing.T) {
+				if s, ts := integral.Sum(c.r), tiled.Sum(c.r); s != ts {
+					t.Errorf("Sum wrong: expected %d, got %d\n", s, ts)
+				}
+				if c.r.Intersect(b).Empty() {
+					return
+				}
+				if m, tm := integral.Mean(c.r), tiled.Mean(c.r); m != tm {
+					t.Errorf("Mean wrong: expected %f, got %f\n", m, tm)
+				}
+			})
+		}
+	}
+}
+
+func TestTiledImageWhite(t *testing.T) {
+	// the largest tiles of the brightest pixels must not overflow
+	img := image.NewGray16(image.Rect(0, 0, 300, 300))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	tiled := NewTiledImage(img, 256)
+	if s := tiled.Sum(img.Bounds()); s != 300*300*0xffff {
+		t.Errorf("Sum wrong: expected %d, got %d\n", 300*300*0xffff, s)
+	}
+}